@@ -18,10 +18,12 @@ type DictPair struct {
 	Value *Expr  `parser:"@@"`
 }
 
+// BlockExpr is a sequence of statements evaluating to its last expression.
+// Bindings made with let inside the block are local to it.
 type BlockExpr struct {
-	LBrace string  `parser:"'{'"`
-	Exprs  []*Expr `parser:"@@*"`
-	RBrace string  `parser:"'}'"`
+	LBrace     string       `parser:"'{'"`
+	Statements []*Statement `parser:"@@*"`
+	RBrace     string       `parser:"'}'"`
 }
 
 type IfExpr struct {
@@ -33,12 +35,82 @@ type IfExpr struct {
 	ElseExpr *Expr  `parser:"@@"`
 }
 
+// WhileExpr repeats its body while the condition holds. Loops evaluate to
+// void.
+type WhileExpr struct {
+	While string     `parser:"'while'"`
+	Cond  *Expr      `parser:"@@"`
+	Body  *BlockExpr `parser:"@@"`
+}
+
+// ForExpr runs its body once per element of a list, key of a dict, or
+// integer in the half-open range Iter..RangeEnd.
+type ForExpr struct {
+	For      string     `parser:"'for'"`
+	Var      string     `parser:"@Ident"`
+	In       string     `parser:"'in'"`
+	Iter     *Expr      `parser:"@@"`
+	RangeEnd *Expr      `parser:"('..' @@)?"`
+	Body     *BlockExpr `parser:"@@"`
+}
+
+// TryExpr evaluates its body and, if a runtime error is raised inside it,
+// evaluates the handler with the error bound to Var instead.
+type TryExpr struct {
+	Try     string     `parser:"'try'"`
+	Body    *BlockExpr `parser:"@@"`
+	Catch   string     `parser:"'catch'"`
+	Var     string     `parser:"@Ident"`
+	Handler *BlockExpr `parser:"@@"`
+}
+
 type Expr struct {
-	If      *IfExpr      `parser:"  @@"`
-	Func    *FuncExpr    `parser:"| @@"`
-	Bin     *Binary      `parser:"| @@"`
-	Block   *BlockExpr   `parser:"| @@"`
-	Primary *PrimaryExpr `parser:"| @@"`
+	If       *IfExpr      `parser:"  @@"`
+	Func     *FuncExpr    `parser:"| @@"`
+	While    *WhileExpr   `parser:"| @@"`
+	For      *ForExpr     `parser:"| @@"`
+	Match    *MatchExpr   `parser:"| @@"`
+	Try      *TryExpr     `parser:"| @@"`
+	Break    bool         `parser:"| @'break'"`
+	Continue bool         `parser:"| @'continue'"`
+	Bin      *Binary      `parser:"| @@"`
+	Block    *BlockExpr   `parser:"| @@"`
+	Primary  *PrimaryExpr `parser:"| @@"`
+}
+
+// AsPrimary returns the primary expression that e consists of, or nil if e
+// is anything more, such as an operator chain or an if.
+func (e *Expr) AsPrimary() *PrimaryExpr {
+	if e.Primary != nil {
+		return e.Primary
+	}
+	if e.Bin == nil || len(e.Bin.Right) > 0 || len(e.Bin.Pipes) > 0 {
+		return nil
+	}
+	and := e.Bin.Left
+	if len(and.Right) > 0 || len(and.Left.Right) > 0 {
+		return nil
+	}
+	add := and.Left.Left
+	if len(add.Right) > 0 || len(add.Left.Right) > 0 {
+		return nil
+	}
+	return add.Left.Left.Primary
+}
+
+// Echoed reports whether the value of e, as a top-level expression
+// statement, is shown when echoing is on. Loops and calls to print and
+// println are not echoed.
+func (e *Expr) Echoed() bool {
+	if e.While != nil || e.For != nil {
+		return false
+	}
+	primary := e.AsPrimary()
+	if primary == nil || len(primary.Postfix) == 0 || primary.Postfix[0].Call == nil {
+		return true
+	}
+	term := primary.Base.Term
+	return term == nil || term.Ident == nil || (*term.Ident != "print" && *term.Ident != "println")
 }
 
 type PrimaryExpr struct {
@@ -47,43 +119,80 @@ type PrimaryExpr struct {
 }
 
 type BaseExpr struct {
-	Term *Term     `parser:"  @@"`
-	List *ListExpr `parser:"| @@"`
-	Dict *DictExpr `parser:"| @@"`
+	Record *RecordLit `parser:"  @@"`
+	Term   *Term      `parser:"| @@"`
+	List   *ListExpr  `parser:"| @@"`
+	Dict   *DictExpr  `parser:"| @@"`
+	Paren  *ParenExpr `parser:"| @@"`
+}
+
+// ParenExpr is a parenthesized expression or, with two or more
+// comma-separated elements, a tuple such as (q, r).
+type ParenExpr struct {
+	LParen string  `parser:"'('"`
+	Expr   *Expr   `parser:"@@"`
+	More   []*Expr `parser:"(',' @@)*"`
+	RParen string  `parser:"')'"`
+}
+
+func (p *ParenExpr) IsTuple() bool {
+	return len(p.More) > 0
+}
+
+// Elems returns the elements of a tuple in order.
+func (p *ParenExpr) Elems() []*Expr {
+	return append([]*Expr{p.Expr}, p.More...)
 }
 
 type Postfix struct {
-	Call  *CallExpr  `parser:"  @@"`
-	Index *IndexExpr `parser:"| @@"`
+	Call  *CallExpr    `parser:"  @@"`
+	Index *IndexExpr   `parser:"| @@"`
+	Field *FieldAccess `parser:"| @@"`
 }
 
 type Program struct {
 	Statements []*Statement `parser:"@@*"`
 }
 
+// Statement is a binding, a type or function declaration, an expression, or
+// an assignment. For an assignment such as xs[i] = v, Expr holds the target
+// and Assign the value.
 type Statement struct {
-	Let  *LetStatement `parser:"  @@"`
-	Expr *Expr         `parser:"| @@"`
+	Let    *LetStatement `parser:"  @@"`
+	Type   *TypeDecl     `parser:"| @@"`
+	Fn     *FnDecl       `parser:"| @@"`
+	Expr   *Expr         `parser:"| @@"`
+	Assign *Expr         `parser:"  ('=' @@)?"`
 }
 
+// LetStatement binds a name, or destructures a value with a pattern such as
+// (q, r) or [first, ..rest]. Bindings made with var can be reassigned;
+// bindings made with let cannot.
 type LetStatement struct {
-	Let      string    `parser:"'let'"`
-	Name     string    `parser:"@Ident"`
+	Let      string    `parser:"@('let' | 'var')"`
+	Name     string    `parser:"(  @Ident"`
+	Pattern  *Pattern  `parser:" | @@ )"`
 	TypeAnno *TypeAnno `parser:"@@?"`
 	Eq       string    `parser:"'='"`
 	Expr     *Expr     `parser:"@@"`
 }
 
+func (l *LetStatement) Mutable() bool {
+	return l.Let == "var"
+}
+
 type TypeAnno struct {
 	Colon string `parser:"':'"`
 	Type  *Type  `parser:"@@"`
 }
 
 type Type struct {
-	Basic    *string   `parser:"  @('int' | 'string' | 'bool' | 'void')"`
-	List     *ListType `parser:"| @@"`
-	Dict     *DictType `parser:"| @@"`
-	Function *FuncType `parser:"| @@"`
+	Basic    *string    `parser:"  @('int' | 'float' | 'string' | 'bool' | 'void')"`
+	List     *ListType  `parser:"| @@"`
+	Dict     *DictType  `parser:"| @@"`
+	Function *FuncType  `parser:"| @@"`
+	Tuple    *TupleType `parser:"| @@"`
+	Named    *string    `parser:"| @Ident"`
 }
 
 type ListType struct {
@@ -100,6 +209,14 @@ type DictType struct {
 	RBrace    string `parser:"'}'"`
 }
 
+// TupleType is the type of a tuple with two or more elements, such as
+// (int, string).
+type TupleType struct {
+	LParen    string  `parser:"'('"`
+	ElemTypes []*Type `parser:"@@ (',' @@)+"`
+	RParen    string  `parser:"')'"`
+}
+
 type FuncType struct {
 	Fn         string  `parser:"'fn'"`
 	LParen     string  `parser:"'('"`
@@ -110,22 +227,180 @@ type FuncType struct {
 }
 
 type Term struct {
-	Number *int    `parser:"  @Int"`
-	String *string `parser:"| @String"`
-	Ident  *string `parser:"| @Ident"`
-	Bool   *bool   `parser:"| @Bool"`
+	Float  *float64       `parser:"  @Float"`
+	Number *int           `parser:"| @Int"`
+	String *string        `parser:"| @String"`
+	Interp *Interpolation `parser:"| @@"`
+	// int, float and bool are also the names of conversion builtins
+	Ident *string  `parser:"| @(Ident | 'int' | 'float' | 'bool')"`
+	Bool  *Boolean `parser:"| @Bool"`
+}
+
+// Interpolation is a string literal with embedded expressions, such as
+// "Hello, ${name}!". The literal text around the expressions is captured
+// from the InterpStart, InterpMid and InterpEnd tokens, still wrapped in
+// their delimiters; use Fragments to get the text itself.
+type Interpolation struct {
+	Start string        `parser:"@InterpStart"`
+	Expr  *Expr         `parser:"@@"`
+	More  []*InterpMore `parser:"@@*"`
+	End   string        `parser:"@InterpEnd"`
+}
+
+type InterpMore struct {
+	Text string `parser:"@InterpMid"`
+	Expr *Expr  `parser:"@@"`
+}
+
+// Fragments returns the literal text and embedded expressions of the string
+// in source order: texts[i] precedes exprs[i], and the final text follows
+// the last expression.
+func (i *Interpolation) Fragments() (texts []string, exprs []*Expr) {
+	// Start is `"text${`, each Text is `}text${` and End is `}text"`
+	texts = append(texts, i.Start[1:len(i.Start)-2])
+	exprs = append(exprs, i.Expr)
+	for _, more := range i.More {
+		texts = append(texts, more.Text[1:len(more.Text)-2])
+		exprs = append(exprs, more.Expr)
+	}
+	texts = append(texts, i.End[1:len(i.End)-1])
+	return texts, exprs
+}
+
+// Boolean captures a Bool token by value; a plain bool field would be set
+// to true whenever the token matched, including for "false".
+type Boolean bool
+
+func (b *Boolean) Capture(values []string) error {
+	*b = values[0] == "true" || values[0] == "yes"
+	return nil
 }
 
 type CallExpr struct {
-	LParen string  `parser:"'('"`
-	Args   []*Expr `parser:"(@@ (',' @@)*)?"`
-	RParen string  `parser:"')'"`
+	SameLine sameLine   `parser:"@@"`
+	LParen   string     `parser:"'('"`
+	Args     []*CallArg `parser:"(@@ (',' @@)*)?"`
+	RParen   string     `parser:"')'"`
+}
+
+// CallArg is an argument of a call, given by position or, as in
+// f(step: 2), by parameter name.
+type CallArg struct {
+	Name  *string `parser:"(@Ident ':')?"`
+	Value *Expr   `parser:"@@"`
 }
 
+// ArgNames returns the parameter name of each argument, or "" for
+// positional ones, or nil if every argument is positional.
+func (c *CallExpr) ArgNames() []string {
+	var names []string
+	for i, arg := range c.Args {
+		if arg.Name != nil {
+			if names == nil {
+				names = make([]string, len(c.Args))
+			}
+			names[i] = *arg.Name
+		}
+	}
+	return names
+}
+
+// Binary is the root of the operator-precedence grammar. From loosest to
+// tightest the levels are pipe, logical or, logical and, comparison,
+// additive, multiplicative and unary. Each level is a left-associative chain
+// of operands from the next level, so 10 - 3 - 2 groups as (10 - 3) - 2.
+// Pipes can only end an expression, so they follow the || chain directly.
 type Binary struct {
-	Left     *PrimaryExpr `parser:"@@"`
-	Operator *string      `parser:"( @('+' | '-' | '==' | '<' | '>')"`
-	Right    *Expr        `parser:"  @@)?"`
+	Left  *LogicalAnd `parser:"@@"`
+	Right []*OrOp     `parser:"@@*"`
+	Pipes []*PipeOp   `parser:"@@*"`
+}
+
+// PipeOp passes the value on its left as the first argument of Target, so
+// xs |> filter(isEven) means filter(xs, isEven) and x |> f means f(x).
+type PipeOp struct {
+	Operator string       `parser:"@'|>'"`
+	Target   *PrimaryExpr `parser:"@@"`
+}
+
+// Piped returns the nested calls that the pipes of b stand for. The value
+// being piped is evaluated once, as the innermost argument.
+func (b *Binary) Piped() *Expr {
+	arg := &Expr{Bin: &Binary{Left: b.Left, Right: b.Right}}
+	for _, pipe := range b.Pipes {
+		arg = &Expr{Primary: pipe.call(arg)}
+	}
+	return arg
+}
+
+// call returns the target called with arg inserted before its arguments,
+// or called with arg alone if it does not end in a call.
+func (p *PipeOp) call(arg *Expr) *PrimaryExpr {
+	postfix := p.Target.Postfix
+	args := []*CallArg{{Value: arg}}
+	if n := len(postfix); n > 0 && postfix[n-1].Call != nil {
+		args = append(args, postfix[n-1].Call.Args...)
+		postfix = postfix[:n-1]
+	}
+	call := &Postfix{Call: &CallExpr{Args: args}}
+	return &PrimaryExpr{
+		Base:    p.Target.Base,
+		Postfix: append(postfix[:len(postfix):len(postfix)], call),
+	}
+}
+
+type OrOp struct {
+	Operator string      `parser:"@'||'"`
+	Right    *LogicalAnd `parser:"@@"`
+}
+
+type LogicalAnd struct {
+	Left  *Comparison `parser:"@@"`
+	Right []*AndOp    `parser:"@@*"`
+}
+
+type AndOp struct {
+	Operator string      `parser:"@'&&'"`
+	Right    *Comparison `parser:"@@"`
+}
+
+type Comparison struct {
+	Left  *Additive    `parser:"@@"`
+	Right []*CompareOp `parser:"@@*"`
+}
+
+type CompareOp struct {
+	Operator string    `parser:"@('==' | '!=' | '<=' | '>=' | '<' | '>')"`
+	Right    *Additive `parser:"@@"`
+}
+
+type Additive struct {
+	Left  *Multiplicative `parser:"@@"`
+	Right []*AddOp        `parser:"@@*"`
+}
+
+type AddOp struct {
+	SameLine sameLineMinus   `parser:"@@"`
+	Operator string          `parser:"@('+' | '-')"`
+	Right    *Multiplicative `parser:"@@"`
+}
+
+type Multiplicative struct {
+	Left  *Unary   `parser:"@@"`
+	Right []*MulOp `parser:"@@*"`
+}
+
+type MulOp struct {
+	Operator string `parser:"@('*' | '/' | '%')"`
+	Right    *Unary `parser:"@@"`
+}
+
+// Unary is the tightest-binding operator level: a prefix operator (! or -)
+// applied to another unary expression, or a primary expression.
+type Unary struct {
+	Operator *string      `parser:"( @('!' | '-')"`
+	Operand  *Unary       `parser:"  @@ )"`
+	Primary  *PrimaryExpr `parser:"| @@"`
 }
 
 type IndexExpr struct {
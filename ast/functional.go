@@ -1,9 +1,36 @@
 package ast
 
-// Enhanced function parameter with optional type annotation
+import "github.com/pranavms13/flux-lang/value"
+
+// Enhanced function parameter with optional type annotation. A parameter
+// can have a default value, used when a call does not give it, and the last
+// parameter can be variadic (...xs), collecting the remaining positional
+// arguments into a list.
 type FuncParam struct {
+	Variadic bool      `parser:"@'...'?"`
 	Name     string    `parser:"@Ident"`
 	TypeAnno *TypeAnno `parser:"@@?"`
+	Default  *Expr     `parser:"('=' @@)?"`
+}
+
+// FnDecl declares a named function at the top level of a program, such as
+// fn fact(n: int): int => if n < 2 then 1 else n * fact(n - 1). Unlike a
+// function bound with let, it is visible in its own body and to every other
+// declaration in the program.
+type FnDecl struct {
+	Fn         string       `parser:"'fn'"`
+	Name       string       `parser:"@Ident"`
+	LParen     string       `parser:"'('"`
+	Params     []*FuncParam `parser:"(@@ (',' @@)*)?"`
+	RParen     string       `parser:"')'"`
+	ReturnAnno *TypeAnno    `parser:"@@?"`
+	Arrow      string       `parser:"@Arrow"`
+	Body       *Expr        `parser:"@@"`
+}
+
+// Func returns the declared function as a function expression.
+func (d *FnDecl) Func() *FuncExpr {
+	return &FuncExpr{Params: d.Params, ReturnAnno: d.ReturnAnno, Body: d.Body}
 }
 
 // Enhanced function expression with type annotations
@@ -16,3 +43,18 @@ type FuncExpr struct {
 	Arrow      string       `parser:"@Arrow"`
 	Body       *Expr        `parser:"@@"`
 }
+
+// Signature describes the parameters of a function for binding the
+// arguments of a call to them.
+func (f *FuncExpr) Signature() *value.Signature {
+	sig := &value.Signature{
+		Params:     make([]string, len(f.Params)),
+		HasDefault: make([]bool, len(f.Params)),
+	}
+	for i, param := range f.Params {
+		sig.Params[i] = param.Name
+		sig.HasDefault[i] = param.Default != nil
+	}
+	sig.Variadic = len(f.Params) > 0 && f.Params[len(f.Params)-1].Variadic
+	return sig
+}
@@ -0,0 +1,127 @@
+package ast
+
+import (
+	"strings"
+
+	"github.com/alecthomas/participle/v2"
+	participlelexer "github.com/alecthomas/participle/v2/lexer"
+	"github.com/pranavms13/flux-lang/lexer"
+)
+
+// Guards are grammar elements that consume no tokens. They look at the
+// tokens around the current position to decide whether the element after
+// them may be parsed there, and return participle.NextMatch if not.
+
+var symbols = lexer.LexerRules.Symbols()
+
+// recordStart matches where a record literal begins, at Name {} or
+// Name { field: ... }, except directly in the header of a while, for or
+// match: there the braces are the body, as in while ready { }. A record
+// literal in a header must be parenthesized.
+type recordStart struct{}
+
+func (*recordStart) Parse(lex *participlelexer.PeekingLexer) error {
+	checkpoint := lex.MakeCheckpoint()
+	name, brace, next, colon := *lex.Next(), *lex.Next(), *lex.Next(), *lex.Next()
+	lex.LoadCheckpoint(checkpoint)
+
+	if name.Type != symbols["Ident"] || brace.Value != "{" {
+		return participle.NextMatch
+	}
+	if next.Value != "}" && (next.Type != symbols["Ident"] || colon.Value != ":") {
+		return participle.NextMatch
+	}
+	if inHeader(lex.Range(0, lex.RawCursor())) {
+		return participle.NextMatch
+	}
+	return nil
+}
+
+// inHeader reports whether the tokens before a position end in the header
+// of a while, for or match, outside any brackets. It scans back to the
+// keyword that starts the header, stopping early at anything that cannot
+// be part of one: an unclosed bracket, the end of a braced block, or the
+// start of a statement, binding or branch.
+func inHeader(before []participlelexer.Token) bool {
+	depth := 0
+	for i := len(before) - 1; i >= 0; i-- {
+		token := before[i]
+		switch token.Type {
+		case symbols["Whitespace"], symbols["SingleLineComment"], symbols["MultiLineComment"]:
+			continue
+		case symbols["NestedClose"], symbols["InterpEnd"]:
+			depth++
+			continue
+		case symbols["NestedOpen"], symbols["InterpStart"], symbols["InterpMid"]:
+			if depth == 0 {
+				return false
+			}
+			depth--
+			continue
+		case symbols["Arrow"]:
+			if depth == 0 {
+				return false
+			}
+			continue
+		case symbols["Keywords"]:
+			if depth > 0 {
+				continue
+			}
+			switch strings.ToLower(token.Value) {
+			case "while", "for", "in", "match":
+				return true
+			case "int", "float", "string", "bool", "void":
+				continue
+			}
+			return false
+		case symbols["Operators"]:
+		default:
+			continue
+		}
+		switch token.Value {
+		case ")", "]":
+			depth++
+		case "}":
+			if depth == 0 {
+				return false
+			}
+			depth++
+		case "(", "[", "{":
+			if depth == 0 {
+				return false
+			}
+			depth--
+		case "=":
+			if depth == 0 {
+				return false
+			}
+		}
+	}
+	return false
+}
+
+// sameLine matches if no line break comes before the next token, so that
+// a line starting with ( or - begins a new expression instead of calling or
+// subtracting from the one on the line before.
+type sameLine struct{}
+
+func (*sameLine) Parse(lex *participlelexer.PeekingLexer) error {
+	_, next := lex.PeekAny(func(participlelexer.Token) bool { return false })
+	for _, token := range lex.Range(lex.RawCursor(), next) {
+		if strings.Contains(token.Value, "\n") {
+			return participle.NextMatch
+		}
+	}
+	return nil
+}
+
+// sameLineMinus is sameLine for a binary - only. Other binary operators at
+// the start of a line still continue the expression before them.
+type sameLineMinus struct{}
+
+func (*sameLineMinus) Parse(lex *participlelexer.PeekingLexer) error {
+	if lex.Peek().Value != "-" {
+		return nil
+	}
+	return (&sameLine{}).Parse(lex)
+}
@@ -0,0 +1,105 @@
+package ast
+
+// MatchExpr evaluates the body of the first arm whose pattern matches the
+// value and whose guard, if any, holds. Arms are separated by commas, which
+// keeps a list pattern on a new line from reading as an index.
+type MatchExpr struct {
+	Match  string      `parser:"'match'"`
+	Value  *Expr       `parser:"@@"`
+	LBrace string      `parser:"'{'"`
+	Arms   []*MatchArm `parser:"(@@ (',' @@)* ','?)?"`
+	RBrace string      `parser:"'}'"`
+}
+
+type MatchArm struct {
+	Pattern *Pattern `parser:"@@"`
+	Guard   *Expr    `parser:"('if' @@)?"`
+	Arrow   string   `parser:"@Arrow"`
+	Body    *Expr    `parser:"@@"`
+}
+
+// Pattern is the left-hand side of a match arm. A Binding matches anything
+// and names it, except for _ which only matches. A binding that names a
+// constructor, such as None, is a constructor pattern without arguments.
+type Pattern struct {
+	Literal     *Literal            `parser:"  @@"`
+	Constructor *ConstructorPattern `parser:"| @@"`
+	Binding     *string             `parser:"| @Ident"`
+	List        *ListPattern        `parser:"| @@"`
+	Dict        *DictPattern        `parser:"| @@"`
+	Tuple       *TuplePattern       `parser:"| @@"`
+}
+
+func (p *Pattern) IsWildcard() bool {
+	return p.Binding != nil && *p.Binding == "_"
+}
+
+// ConstructorPattern matches a variant built by the named constructor and
+// matches its arguments against Args, such as Rect(w, h).
+type ConstructorPattern struct {
+	Name   string     `parser:"@Ident '('"`
+	Args   []*Pattern `parser:"(@@ (',' @@)*)?"`
+	RParen string     `parser:"')'"`
+}
+
+// Literal is a constant in a pattern. Numbers may be negative.
+type Literal struct {
+	Negative bool     `parser:"(  @'-'?"`
+	Float    *float64 `parser:"   ( @Float"`
+	Number   *int     `parser:"   | @Int ) )"`
+	String   *string  `parser:"| @String"`
+	Bool     *Boolean `parser:"| @Bool"`
+}
+
+// Value returns the literal as a runtime value.
+func (l *Literal) Value() interface{} {
+	switch {
+	case l.Float != nil && l.Negative:
+		return -*l.Float
+	case l.Float != nil:
+		return *l.Float
+	case l.Number != nil && l.Negative:
+		return -*l.Number
+	case l.Number != nil:
+		return *l.Number
+	case l.String != nil:
+		return *l.String
+	default:
+		return bool(*l.Bool)
+	}
+}
+
+// ListPattern matches a list element by element. Without a rest pattern the
+// lengths must be equal; with one, ..name binds the remaining elements.
+type ListPattern struct {
+	LBrack string       `parser:"'['"`
+	Elems  []*Pattern   `parser:"(@@ (',' @@)*)?"`
+	Rest   *RestPattern `parser:"(','? @@)?"`
+	RBrack string       `parser:"']'"`
+}
+
+type RestPattern struct {
+	Dots string  `parser:"'..'"`
+	Name *string `parser:"@Ident?"`
+}
+
+// TuplePattern matches a tuple with exactly as many elements.
+type TuplePattern struct {
+	LParen string     `parser:"'('"`
+	Elems  []*Pattern `parser:"@@ (',' @@)+"`
+	RParen string     `parser:"')'"`
+}
+
+// DictPattern matches a dict that has all of the given keys, ignoring any
+// others.
+type DictPattern struct {
+	LBrace  string              `parser:"'{'"`
+	Entries []*DictPatternEntry `parser:"(@@ (',' @@)*)?"`
+	RBrace  string              `parser:"'}'"`
+}
+
+type DictPatternEntry struct {
+	Key   *Literal `parser:"@@"`
+	Colon string   `parser:"':'"`
+	Value *Pattern `parser:"@@"`
+}
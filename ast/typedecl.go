@@ -0,0 +1,52 @@
+package ast
+
+// TypeDecl declares a named type: a record, such as
+// type User = { name: string, age: int }, or a sum type, such as
+// type Shape = Circle(int) | Rect(int, int).
+type TypeDecl struct {
+	Type     string         `parser:"'type'"`
+	Name     string         `parser:"@Ident"`
+	Eq       string         `parser:"'='"`
+	Record   *RecordType    `parser:"(  @@"`
+	Variants []*VariantDecl `parser:" | @@ ('|' @@)* )"`
+}
+
+type RecordType struct {
+	LBrace string         `parser:"'{'"`
+	Fields []*RecordField `parser:"(@@ (',' @@)* ','?)?"`
+	RBrace string         `parser:"'}'"`
+}
+
+type RecordField struct {
+	Name  string `parser:"@Ident"`
+	Colon string `parser:"':'"`
+	Type  *Type  `parser:"@@"`
+}
+
+// VariantDecl is one constructor of a sum type. A constructor without
+// fields is written without parentheses.
+type VariantDecl struct {
+	Name   string  `parser:"@Ident"`
+	Fields []*Type `parser:"('(' (@@ (',' @@)*)? ')')?"`
+}
+
+// RecordLit builds a record, such as User { name: "Ada", age: 36 }.
+type RecordLit struct {
+	Start  recordStart  `parser:"@@"`
+	Name   string       `parser:"@Ident"`
+	LBrace string       `parser:"'{'"`
+	Fields []*FieldInit `parser:"(@@ (',' @@)* ','?)?"`
+	RBrace string       `parser:"'}'"`
+}
+
+type FieldInit struct {
+	Name  string `parser:"@Ident"`
+	Colon string `parser:"':'"`
+	Value *Expr  `parser:"@@"`
+}
+
+// FieldAccess is a postfix .name selecting a field of a record.
+type FieldAccess struct {
+	Dot  string `parser:"'.'"`
+	Name string `parser:"@Ident"`
+}
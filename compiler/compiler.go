@@ -1,7 +1,10 @@
 package compiler
 
 import (
+	"errors"
+
 	"github.com/pranavms13/flux-lang/ast"
+	"github.com/pranavms13/flux-lang/value"
 	"github.com/pranavms13/flux-lang/vm"
 )
 
@@ -9,61 +12,304 @@ type FluxCompiler struct {
 	chunk *vm.Chunk
 	// Add type tracking
 	globalTypes map[string]string // Maps variable names to their types
+	// Scope of the function currently being compiled
+	scope *funcScope
+	// Record types and sum type constructors declared by the program, by
+	// name
+	records  map[string]*value.RecordDecl
+	variants map[string]*value.VariantDecl
+	config   Config
+	// First error found in the program, returned by Compile
+	err error
+}
+
+// Config controls code generation. With Echo set, the values of top-level
+// expression statements are printed, as a REPL would show them.
+type Config struct {
+	Echo bool
+}
+
+// funcScope tracks the local slots and captured variables of a function
+// while its body is being compiled. The top-level script has a funcScope of
+// its own whose outermost bindings are globals.
+type funcScope struct {
+	enclosing *funcScope
+	chunk     *vm.Chunk
+	locals    []local
+	// Block nesting depth; parameters live at depth 0
+	depth int
+	// Enclosing loops, innermost last
+	loops []*loop
+	// Number of try bodies being compiled
+	tries int
+}
+
+// loop tracks the jump targets of a loop being compiled.
+type loop struct {
+	// Where continue jumps back to
+	start int
+	// Forward jumps from break statements, patched at the loop exit
+	breakJumps []int
+	// First local slot declared inside the loop body
+	firstLocal int
+	// Try bodies entered outside the loop
+	tries int
+}
+
+type local struct {
+	name  string
+	depth int
+	// Set when a closure captures the local, so its upvalue must be closed
+	// before the slot is reused
+	captured bool
 }
 
 func NewFluxCompiler() *FluxCompiler {
+	return NewFluxCompilerWithConfig(Config{})
+}
+
+func NewFluxCompilerWithConfig(cfg Config) *FluxCompiler {
+	chunk := &vm.Chunk{}
 	return &FluxCompiler{
-		chunk:       &vm.Chunk{},
+		chunk:       chunk,
 		globalTypes: make(map[string]string),
+		scope:       &funcScope{chunk: chunk},
+		records:     make(map[string]*value.RecordDecl),
+		variants:    make(map[string]*value.VariantDecl),
+		config:      cfg,
+	}
+}
+
+func (s *funcScope) resolveLocal(name string) int {
+	for i := len(s.locals) - 1; i >= 0; i-- {
+		if s.locals[i].name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// declareLocal gives name the next free slot in the current block.
+func (s *funcScope) declareLocal(name string) int {
+	s.locals = append(s.locals, local{name: name, depth: s.depth})
+	if len(s.locals) > s.chunk.NumLocals {
+		s.chunk.NumLocals = len(s.locals)
+	}
+	return len(s.locals) - 1
+}
+
+// isGlobal reports whether a let at the current position defines a global.
+func (s *funcScope) isGlobal() bool {
+	return s.enclosing == nil && s.depth == 0
+}
+
+// resolveUpvalue finds name in an enclosing function and threads it through
+// the upvalue lists of every function in between.
+func (s *funcScope) resolveUpvalue(name string) int {
+	if s.enclosing == nil {
+		return -1
+	}
+	if slot := s.enclosing.resolveLocal(name); slot != -1 {
+		s.enclosing.locals[slot].captured = true
+		return s.addUpvalue(true, slot)
+	}
+	if idx := s.enclosing.resolveUpvalue(name); idx != -1 {
+		return s.addUpvalue(false, idx)
+	}
+	return -1
+}
+
+func (s *funcScope) addUpvalue(isLocal bool, index int) int {
+	for i, ref := range s.chunk.Upvalues {
+		if ref.IsLocal == isLocal && ref.Index == index {
+			return i
+		}
 	}
+	s.chunk.Upvalues = append(s.chunk.Upvalues, vm.UpvalueRef{IsLocal: isLocal, Index: index})
+	return len(s.chunk.Upvalues) - 1
 }
 
-func (c *FluxCompiler) Compile(prog *ast.Program) *vm.Chunk {
+// Compile compiles a program to the chunk of its top-level script. It
+// returns the first error found if the program cannot be compiled.
+func (c *FluxCompiler) Compile(prog *ast.Program) (*vm.Chunk, error) {
+	// Type declarations are visible throughout the program
+	for _, stmt := range prog.Statements {
+		if stmt.Type != nil {
+			c.declareType(stmt.Type)
+		}
+	}
+	// So are named functions. Their bodies find each other as globals, so
+	// defining them all before anything runs is enough for mutual recursion.
+	for _, stmt := range prog.Statements {
+		if stmt.Fn != nil {
+			c.compileExpr(&ast.Expr{Func: stmt.Fn.Func()})
+			c.emit(vm.OpDefineGlobal, c.addConstant(stmt.Fn.Name)...)
+		}
+	}
 	for _, stmt := range prog.Statements {
 		c.compileStmt(stmt)
 	}
 	c.emit(vm.OpReturn)
-	return c.chunk
+	c.checkFrame(c.chunk)
+	if c.err != nil {
+		return nil, c.err
+	}
+	return c.chunk, nil
 }
 
-func (c *FluxCompiler) compileStmt(stmt *ast.Statement) {
-	if stmt.Expr != nil {
-		c.compileExpr(stmt.Expr)
-		// Only print if it's not a print call and not an array indexing
-		isPrint := false
-		isIndexing := false
-		if stmt.Expr.Primary != nil {
-			if stmt.Expr.Primary.Base != nil && stmt.Expr.Primary.Base.Term != nil && stmt.Expr.Primary.Base.Term.Ident != nil && *stmt.Expr.Primary.Base.Term.Ident == "print" {
-				if len(stmt.Expr.Primary.Postfix) > 0 && stmt.Expr.Primary.Postfix[0].Call != nil {
-					isPrint = true
-				}
-			}
-			if len(stmt.Expr.Primary.Postfix) > 0 && stmt.Expr.Primary.Postfix[0].Index != nil {
-				isIndexing = true
+// reportError records a compile error. Compilation goes on so that the caller
+// does not have to unwind, but the chunk is discarded.
+func (c *FluxCompiler) reportError(msg string) {
+	if c.err == nil {
+		c.err = errors.New(msg)
+	}
+}
+
+// declareType registers a record type, or defines the constructors of a sum
+// type as globals at the start of the script. A constructor without fields
+// is bound to its only value.
+func (c *FluxCompiler) declareType(decl *ast.TypeDecl) {
+	if decl.Record == nil {
+		for _, variant := range decl.Variants {
+			ctor := &value.VariantDecl{Type: decl.Name, Name: variant.Name, Arity: len(variant.Fields)}
+			c.variants[variant.Name] = ctor
+			var v interface{} = ctor
+			if ctor.Arity == 0 {
+				v = value.NewVariant(ctor, nil)
 			}
+			c.emit(vm.OpConstant, c.addConstant(v)...)
+			c.emit(vm.OpDefineGlobal, c.addConstant(variant.Name)...)
 		}
-		if !isPrint && !isIndexing {
+		return
+	}
+	fields := make([]string, len(decl.Record.Fields))
+	for i, field := range decl.Record.Fields {
+		fields[i] = field.Name
+	}
+	c.records[decl.Name] = &value.RecordDecl{Name: decl.Name, Fields: fields}
+}
+
+func (c *FluxCompiler) compileStmt(stmt *ast.Statement) {
+	if stmt.Assign != nil {
+		c.compileAssign(stmt.Expr, stmt.Assign)
+	} else if stmt.Expr != nil {
+		c.compileExpr(stmt.Expr)
+		if c.config.Echo && stmt.Expr.Echoed() {
 			c.emit(vm.OpPrint)
+		} else {
+			c.emit(vm.OpPop)
 		}
 	} else if stmt.Let != nil {
-		c.compileExpr(stmt.Let.Expr)
-		// Store the value in globals
-		idx := c.addConstant(stmt.Let.Name)
-		c.emit(vm.OpDefineGlobal, byte(idx))
-
-		// Track the type of the variable
-		if stmt.Let.Expr.Primary != nil {
-			if stmt.Let.Expr.Primary.Base != nil {
-				if stmt.Let.Expr.Primary.Base.List != nil {
-					c.globalTypes[stmt.Let.Name] = "list"
-				} else if stmt.Let.Expr.Primary.Base.Dict != nil {
-					c.globalTypes[stmt.Let.Name] = "dict"
-				}
+		c.compileLet(stmt.Let)
+	}
+}
+
+// compileLet binds a let statement: to a global at the top level of the
+// script, otherwise to a slot in the enclosing block. The initializer is
+// compiled first so it still sees any outer binding of the same name.
+func (c *FluxCompiler) compileLet(let *ast.LetStatement) {
+	if let.Pattern != nil {
+		c.compileDestructure(let)
+		return
+	}
+	if !c.scope.isGlobal() {
+		c.compileExpr(let.Expr)
+		slot := c.scope.declareLocal(let.Name)
+		c.emit(vm.OpSetLocal, byte(slot))
+		return
+	}
+
+	c.compileExpr(let.Expr)
+	// Store the value in globals
+	c.emit(vm.OpDefineGlobal, c.addConstant(let.Name)...)
+
+	// Track the type of the variable
+	if let.Expr.Primary != nil {
+		if let.Expr.Primary.Base != nil {
+			if let.Expr.Primary.Base.List != nil {
+				c.globalTypes[let.Name] = "list"
+			} else if let.Expr.Primary.Base.Dict != nil {
+				c.globalTypes[let.Name] = "dict"
 			}
 		}
 	}
 }
 
+// compileDestructure binds the variables of a let pattern. The pattern
+// stores them in local slots; at the top level of the script they only live
+// there long enough to be copied into globals.
+func (c *FluxCompiler) compileDestructure(let *ast.LetStatement) {
+	c.compileExpr(let.Expr)
+	global := c.scope.isGlobal()
+	if global {
+		c.beginScope()
+	}
+	first := len(c.scope.locals)
+	c.emit(vm.OpDestructure, c.addConstant(c.compilePattern(let.Pattern))...)
+	if !global {
+		return
+	}
+	for slot, local := range c.scope.locals[first:] {
+		c.emit(vm.OpGetLocal, byte(first+slot))
+		c.emit(vm.OpDefineGlobal, c.addConstant(local.name)...)
+	}
+	c.endScope()
+}
+
+// compileAssign stores the value of rhs in target: a variable, an indexing
+// expression or a record field. It leaves nothing on the stack.
+func (c *FluxCompiler) compileAssign(target, rhs *ast.Expr) {
+	primary := target.AsPrimary()
+	if primary != nil && primary.Base != nil && len(primary.Postfix) == 0 &&
+		primary.Base.Term != nil && primary.Base.Term.Ident != nil {
+		name := *primary.Base.Term.Ident
+		c.compileExpr(rhs)
+		if slot := c.scope.resolveLocal(name); slot != -1 {
+			c.emit(vm.OpSetLocal, byte(slot))
+		} else if idx := c.scope.resolveUpvalue(name); idx != -1 {
+			c.emit(vm.OpSetUpvalue, byte(idx))
+		} else {
+			c.emit(vm.OpSetGlobal, c.addConstant(name)...)
+		}
+		return
+	}
+
+	if primary == nil || primary.Base == nil || len(primary.Postfix) == 0 ||
+		primary.Postfix[len(primary.Postfix)-1].Call != nil {
+		c.reportError("invalid assignment target")
+		return
+	}
+	// Evaluate the container and index, then the value, and store it
+	last := primary.Postfix[len(primary.Postfix)-1]
+	c.compileExpr(&ast.Expr{Primary: &ast.PrimaryExpr{
+		Base:    primary.Base,
+		Postfix: primary.Postfix[:len(primary.Postfix)-1],
+	}})
+	if last.Field != nil {
+		c.compileExpr(rhs)
+		c.emit(vm.OpSetField, c.addConstant(last.Field.Name)...)
+		return
+	}
+	c.compileExpr(last.Index.Index)
+	c.compileExpr(rhs)
+	c.emit(vm.OpSetIndex)
+}
+
+// compileRecord pushes each field value followed by its name, like the
+// key-value pairs of a dict, and builds the record with OpRecord.
+func (c *FluxCompiler) compileRecord(lit *ast.RecordLit) {
+	decl, ok := c.records[lit.Name]
+	if !ok {
+		c.reportError("unknown type: " + lit.Name)
+		return
+	}
+	for _, field := range lit.Fields {
+		c.compileExpr(field.Value)
+		c.emit(vm.OpConstant, c.addConstant(field.Name)...)
+	}
+	c.emit(vm.OpRecord, append(c.addConstant(decl), c.operand(len(lit.Fields), "fields in a record literal"))...)
+}
+
 func (c *FluxCompiler) compileExpr(expr *ast.Expr) {
 	if expr == nil {
 		return
@@ -72,23 +318,27 @@ func (c *FluxCompiler) compileExpr(expr *ast.Expr) {
 	case expr.Primary != nil:
 		// Compile the base value
 		if expr.Primary.Base != nil {
-			if expr.Primary.Base.Term != nil {
+			if expr.Primary.Base.Record != nil {
+				c.compileRecord(expr.Primary.Base.Record)
+			} else if expr.Primary.Base.Term != nil {
 				t := expr.Primary.Base.Term
 				if t.Number != nil {
-					idx := c.addConstant(*t.Number)
-					c.emit(vm.OpConstant, byte(idx))
+					c.emit(vm.OpConstant, c.addConstant(*t.Number)...)
+				}
+				if t.Float != nil {
+					c.emit(vm.OpConstant, c.addConstant(*t.Float)...)
 				}
 				if t.String != nil {
-					idx := c.addConstant(*t.String)
-					c.emit(vm.OpConstant, byte(idx))
+					c.emit(vm.OpConstant, c.addConstant(*t.String)...)
+				}
+				if t.Interp != nil {
+					c.compileInterpolation(t.Interp)
 				}
 				if t.Bool != nil {
-					idx := c.addConstant(*t.Bool)
-					c.emit(vm.OpConstant, byte(idx))
+					c.emit(vm.OpConstant, c.addConstant(bool(*t.Bool))...)
 				}
 				if t.Ident != nil {
-					idx := c.addConstant(*t.Ident)
-					c.emit(vm.OpGetGlobal, byte(idx))
+					c.compileIdent(*t.Ident)
 				}
 			} else if expr.Primary.Base.List != nil {
 				// First compile all elements
@@ -96,7 +346,16 @@ func (c *FluxCompiler) compileExpr(expr *ast.Expr) {
 					c.compileExpr(e)
 				}
 				// Then create the array from the elements
-				c.emit(vm.OpArray, byte(len(expr.Primary.Base.List.Elems)))
+				c.emit(vm.OpArray, c.operand(len(expr.Primary.Base.List.Elems), "elements in a list literal"))
+			} else if paren := expr.Primary.Base.Paren; paren != nil {
+				if paren.IsTuple() {
+					for _, e := range paren.Elems() {
+						c.compileExpr(e)
+					}
+					c.emit(vm.OpTuple, c.operand(len(paren.Elems()), "elements in a tuple"))
+				} else {
+					c.compileExpr(paren.Expr)
+				}
 			} else if expr.Primary.Base.Dict != nil {
 				// First compile all key-value pairs
 				for _, pair := range expr.Primary.Base.Dict.Pairs {
@@ -104,7 +363,7 @@ func (c *FluxCompiler) compileExpr(expr *ast.Expr) {
 					c.compileExpr(pair.Key)
 				}
 				// Then create the dictionary from the pairs
-				c.emit(vm.OpDict, byte(len(expr.Primary.Base.Dict.Pairs)))
+				c.emit(vm.OpDict, c.operand(len(expr.Primary.Base.Dict.Pairs), "entries in a dict literal"))
 			}
 		}
 		// Compile chained postfix expressions
@@ -112,10 +371,16 @@ func (c *FluxCompiler) compileExpr(expr *ast.Expr) {
 			if pf.Call != nil {
 				// First compile all arguments
 				for _, arg := range pf.Call.Args {
-					c.compileExpr(arg)
+					c.compileExpr(arg.Value)
 				}
 				// Then emit the call instruction
-				c.emit(vm.OpCall, byte(len(pf.Call.Args)))
+				if names := pf.Call.ArgNames(); names != nil {
+					c.emit(vm.OpCallNamed, append([]byte{c.operand(len(pf.Call.Args), "arguments")}, c.addConstant(names)...)...)
+				} else {
+					c.emit(vm.OpCall, c.operand(len(pf.Call.Args), "arguments"))
+				}
+			} else if pf.Field != nil {
+				c.emit(vm.OpGetField, c.addConstant(pf.Field.Name)...)
 			} else if pf.Index != nil {
 				c.compileExpr(pf.Index.Index)
 				// Check if we're accessing a dictionary by looking at the base expression
@@ -145,60 +410,479 @@ func (c *FluxCompiler) compileExpr(expr *ast.Expr) {
 			}
 		}
 	case expr.Block != nil:
-		for _, e := range expr.Block.Exprs {
-			c.compileExpr(e)
-		}
+		c.compileBlock(expr.Block)
 	case expr.If != nil:
 		c.compileExpr(expr.If.Cond)
-		jumpIfFalsePos := len(c.chunk.Code)
-		c.emit(vm.OpJumpIfFalse, 0)
+		jumpIfFalsePos := c.emitJump(vm.OpJumpIfFalse)
+		c.emit(vm.OpPop)
 		c.compileExpr(expr.If.ThenExpr)
-		jumpToEndPos := len(c.chunk.Code)
-		c.emit(vm.OpJump, 0)
-		elsePos := len(c.chunk.Code)
-		c.chunk.Code[jumpIfFalsePos+1] = byte(elsePos)
+		jumpToEndPos := c.emitJump(vm.OpJump)
+		c.patchJump(jumpIfFalsePos)
+		c.emit(vm.OpPop)
 		c.compileExpr(expr.If.ElseExpr)
-		endPos := len(c.chunk.Code)
-		c.chunk.Code[jumpToEndPos+1] = byte(endPos)
+		c.patchJump(jumpToEndPos)
 	case expr.Func != nil:
-		// Extract parameter names from FuncParam structures
-		paramNames := make([]string, len(expr.Func.Params))
-		for i, param := range expr.Func.Params {
-			paramNames[i] = param.Name
-		}
-
 		fnChunk := &vm.Chunk{
-			Params: paramNames,
+			Signature: expr.Func.Signature(),
 		}
 		oldChunk := c.chunk
 		c.chunk = fnChunk
+		// Parameters occupy the first local slots of the new frame
+		c.scope = &funcScope{enclosing: c.scope, chunk: fnChunk}
+		for _, param := range expr.Func.Params {
+			c.scope.declareLocal(param.Name)
+		}
+		// Parameters the call did not give get their default values, which
+		// can refer to the parameters before them
+		for i, param := range expr.Func.Params {
+			if param.Default != nil {
+				skip := c.emitJump(vm.OpDefault, byte(i))
+				c.compileExpr(param.Default)
+				c.emit(vm.OpSetLocal, byte(i))
+				c.patchJump(skip)
+			}
+		}
 		c.compileExpr(expr.Func.Body)
 		c.emit(vm.OpReturn)
+		c.checkFrame(fnChunk)
+		c.scope = c.scope.enclosing
 		c.chunk = oldChunk
-		idx := c.addConstant(fnChunk)
-		c.emit(vm.OpClosure, byte(idx))
+		c.emit(vm.OpClosure, c.addConstant(fnChunk)...)
+	case expr.While != nil:
+		c.compileWhile(expr.While)
+	case expr.For != nil:
+		c.compileFor(expr.For)
+	case expr.Match != nil:
+		c.compileMatch(expr.Match)
+	case expr.Try != nil:
+		c.compileTry(expr.Try)
+	case expr.Break, expr.Continue:
+		c.compileLoopExit(expr.Break)
 	case expr.Bin != nil:
-		if expr.Bin.Left != nil {
-			c.compileExpr(&ast.Expr{Primary: expr.Bin.Left})
-		}
-		if expr.Bin.Right != nil {
-			c.compileExpr(expr.Bin.Right)
-		}
-		if expr.Bin.Operator != nil {
-			switch *expr.Bin.Operator {
-			case "+":
-				c.emit(vm.OpAdd)
-			case "-":
-				c.emit(vm.OpSub)
-			case "==":
-				c.emit(vm.OpEqual)
-			case ">":
-				c.emit(vm.OpGreater)
-			case "<":
-				c.emit(vm.OpLess)
+		c.compileBinary(expr.Bin)
+	}
+}
+
+func (c *FluxCompiler) compileWhile(while *ast.WhileExpr) {
+	start := len(c.chunk.Code)
+	c.compileExpr(while.Cond)
+	exitJump := c.emitJump(vm.OpJumpIfFalse)
+	c.emit(vm.OpPop)
+	l := c.beginLoop(start)
+	c.compileBlock(while.Body)
+	c.emit(vm.OpPop)
+	c.emitLoop(start)
+	c.patchJump(exitJump)
+	c.emit(vm.OpPop)
+	c.endLoop(l)
+}
+
+// compileFor keeps the loop's iterator in a hidden local slot. Each pass
+// binds the loop variable in a scope of its own, so closures created in the
+// body capture that iteration's value.
+func (c *FluxCompiler) compileFor(loop *ast.ForExpr) {
+	c.beginScope()
+	c.compileExpr(loop.Iter)
+	if loop.RangeEnd != nil {
+		c.compileExpr(loop.RangeEnd)
+		c.emit(vm.OpRange)
+	} else {
+		c.emit(vm.OpIter)
+	}
+	iterSlot := c.scope.declareLocal("")
+	c.emit(vm.OpSetLocal, byte(iterSlot))
+
+	start := len(c.chunk.Code)
+	exitJump := c.emitJump(vm.OpForNext, byte(iterSlot))
+	l := c.beginLoop(start)
+	c.beginScope()
+	c.emit(vm.OpSetLocal, byte(c.scope.declareLocal(loop.Var)))
+	c.compileBlock(loop.Body)
+	c.emit(vm.OpPop)
+	c.endScope()
+	c.emitLoop(start)
+	c.patchJump(exitJump)
+	c.endLoop(l)
+	c.endScope()
+}
+
+// compileMatch keeps the matched value in a hidden local and tries each arm
+// in turn. OpMatch stores an arm's bindings straight into its local slots.
+func (c *FluxCompiler) compileMatch(match *ast.MatchExpr) {
+	c.beginScope()
+	c.compileExpr(match.Value)
+	valueSlot := c.scope.declareLocal("")
+	c.emit(vm.OpSetLocal, byte(valueSlot))
+
+	var endJumps []int
+	for _, arm := range match.Arms {
+		c.beginScope()
+		first := len(c.scope.locals)
+		pattern := c.addConstant(c.compilePattern(arm.Pattern))
+		c.emit(vm.OpGetLocal, byte(valueSlot))
+		c.emit(vm.OpMatch, pattern...)
+		failJumps := []int{c.emitJump(vm.OpJumpIfFalse)}
+		c.emit(vm.OpPop)
+		if arm.Guard != nil {
+			c.compileExpr(arm.Guard)
+			failJumps = append(failJumps, c.emitJump(vm.OpJumpIfFalse))
+			c.emit(vm.OpPop)
+		}
+		c.compileExpr(arm.Body)
+		captured := c.endScope()
+		endJumps = append(endJumps, c.emitJump(vm.OpJump))
+
+		for _, pos := range failJumps {
+			c.patchJump(pos)
+		}
+		c.emit(vm.OpPop)
+		if captured {
+			// A guard may have captured the arm's bindings
+			c.emit(vm.OpCloseUpvalues, byte(first))
+		}
+	}
+	c.emit(vm.OpGetLocal, byte(valueSlot))
+	c.emit(vm.OpNoMatch)
+
+	for _, pos := range endJumps {
+		c.patchJump(pos)
+	}
+	c.endScope()
+}
+
+// compilePattern translates a pattern, declaring its bindings as locals of
+// the current scope in the order they appear.
+func (c *FluxCompiler) compilePattern(pattern *ast.Pattern) *vm.Pattern {
+	switch {
+	case pattern.Literal != nil:
+		return &vm.Pattern{Kind: vm.PatLiteral, Literal: pattern.Literal.Value()}
+	case pattern.Constructor != nil:
+		return c.compileVariantPattern(pattern.Constructor.Name, pattern.Constructor.Args)
+	case pattern.IsWildcard():
+		return &vm.Pattern{Kind: vm.PatWildcard}
+	case pattern.Binding != nil && c.variants[*pattern.Binding] != nil:
+		return c.compileVariantPattern(*pattern.Binding, nil)
+	case pattern.Binding != nil:
+		return &vm.Pattern{Kind: vm.PatBind, Slot: c.scope.declareLocal(*pattern.Binding)}
+	case pattern.Tuple != nil:
+		p := &vm.Pattern{Kind: vm.PatTuple}
+		for _, elem := range pattern.Tuple.Elems {
+			p.Elems = append(p.Elems, c.compilePattern(elem))
+		}
+		return p
+	case pattern.List != nil:
+		p := &vm.Pattern{Kind: vm.PatList, RestSlot: -1}
+		for _, elem := range pattern.List.Elems {
+			p.Elems = append(p.Elems, c.compilePattern(elem))
+		}
+		if rest := pattern.List.Rest; rest != nil {
+			p.HasRest = true
+			if rest.Name != nil && *rest.Name != "_" {
+				p.RestSlot = c.scope.declareLocal(*rest.Name)
 			}
 		}
+		return p
+	default:
+		p := &vm.Pattern{Kind: vm.PatDict}
+		for _, entry := range pattern.Dict.Entries {
+			p.Keys = append(p.Keys, entry.Key.Value())
+			p.Elems = append(p.Elems, c.compilePattern(entry.Value))
+		}
+		return p
+	}
+}
+
+func (c *FluxCompiler) compileVariantPattern(name string, args []*ast.Pattern) *vm.Pattern {
+	ctor, ok := c.variants[name]
+	if !ok {
+		c.reportError("unknown constructor: " + name)
+	}
+	p := &vm.Pattern{Kind: vm.PatVariant, Ctor: ctor}
+	for _, arg := range args {
+		p.Elems = append(p.Elems, c.compilePattern(arg))
+	}
+	return p
+}
+
+// compileTry registers the catch block with OpTry before running the body.
+// If the body finishes, OpEndTry removes the handler and the catch block is
+// skipped; if it raises an error, the VM unwinds to the catch block with the
+// error on the stack.
+func (c *FluxCompiler) compileTry(try *ast.TryExpr) {
+	handlerJump := c.emitJump(vm.OpTry, byte(len(c.scope.locals)))
+	c.scope.tries++
+	c.compileBlock(try.Body)
+	c.scope.tries--
+	c.emit(vm.OpEndTry)
+	endJump := c.emitJump(vm.OpJump)
+
+	c.patchJump(handlerJump)
+	c.beginScope()
+	c.emit(vm.OpSetLocal, byte(c.scope.declareLocal(try.Var)))
+	c.compileBlock(try.Handler)
+	c.endScope()
+	c.patchJump(endJump)
+}
+
+func (c *FluxCompiler) beginLoop(start int) *loop {
+	l := &loop{start: start, firstLocal: len(c.scope.locals), tries: c.scope.tries}
+	c.scope.loops = append(c.scope.loops, l)
+	return l
+}
+
+// endLoop lands pending breaks at the current position and pushes the void
+// value of the loop.
+func (c *FluxCompiler) endLoop(l *loop) {
+	for _, pos := range l.breakJumps {
+		c.patchJump(pos)
+	}
+	c.scope.loops = c.scope.loops[:len(c.scope.loops)-1]
+	c.emit(vm.OpNil)
+}
+
+// compileLoopExit compiles break (isBreak) or continue. Upvalues of locals
+// declared inside the loop are closed first, and handlers of try bodies
+// inside the loop are removed, since jumping out of the body skips the end
+// of their scopes.
+func (c *FluxCompiler) compileLoopExit(isBreak bool) {
+	s := c.scope
+	if len(s.loops) == 0 {
+		c.reportError("break or continue outside of a loop")
+		return
+	}
+	l := s.loops[len(s.loops)-1]
+	for _, local := range s.locals[l.firstLocal:] {
+		if local.captured {
+			c.emit(vm.OpCloseUpvalues, byte(l.firstLocal))
+			break
+		}
+	}
+	for i := l.tries; i < s.tries; i++ {
+		c.emit(vm.OpEndTry)
+	}
+	if isBreak {
+		l.breakJumps = append(l.breakJumps, c.emitJump(vm.OpJump))
+	} else {
+		c.emitLoop(l.start)
+	}
+}
+
+// compileBlock compiles the statements of a block, leaving the value of the
+// last one on the stack. A block that is empty or ends in a let, an
+// assignment or a declaration is void.
+func (c *FluxCompiler) compileBlock(block *ast.BlockExpr) {
+	c.beginScope()
+	producedValue := false
+	for _, stmt := range block.Statements {
+		if producedValue {
+			// Only the last expression is the value of the block
+			c.emit(vm.OpPop)
+		}
+		if stmt.Let != nil {
+			c.compileLet(stmt.Let)
+			producedValue = false
+		} else if stmt.Assign != nil {
+			c.compileAssign(stmt.Expr, stmt.Assign)
+			producedValue = false
+		} else if stmt.Type != nil || stmt.Fn != nil {
+			// Declared before compilation
+			producedValue = false
+		} else {
+			c.compileExpr(stmt.Expr)
+			producedValue = true
+		}
 	}
+	if !producedValue {
+		c.emit(vm.OpNil)
+	}
+	c.endScope()
+}
+
+func (c *FluxCompiler) beginScope() {
+	c.scope.depth++
+}
+
+// endScope discards the locals of the innermost block. If a closure captured
+// any of them, their upvalues are closed first because the slots are reused;
+// the result reports whether that was needed.
+func (c *FluxCompiler) endScope() bool {
+	s := c.scope
+	s.depth--
+	first := len(s.locals)
+	captured := false
+	for first > 0 && s.locals[first-1].depth > s.depth {
+		first--
+		captured = captured || s.locals[first].captured
+	}
+	if captured {
+		c.emit(vm.OpCloseUpvalues, byte(first))
+	}
+	s.locals = s.locals[:first]
+	return captured
+}
+
+// compileBinary compiles an || chain. Each truthy operand jumps straight to
+// the end with its value left on the stack; otherwise it is popped and the
+// next operand is evaluated.
+func (c *FluxCompiler) compileBinary(bin *ast.Binary) {
+	// Pipes compile to the same code as the calls they stand for
+	if len(bin.Pipes) > 0 {
+		c.compileExpr(bin.Piped())
+		return
+	}
+	c.compileLogicalAnd(bin.Left)
+	var endJumps []int
+	for _, op := range bin.Right {
+		endJumps = append(endJumps, c.emitJump(vm.OpJumpIfTrue))
+		c.emit(vm.OpPop)
+		c.compileLogicalAnd(op.Right)
+	}
+	for _, pos := range endJumps {
+		c.patchJump(pos)
+	}
+}
+
+// compileLogicalAnd compiles an && chain, short-circuiting on the first
+// falsy operand.
+func (c *FluxCompiler) compileLogicalAnd(and *ast.LogicalAnd) {
+	c.compileComparison(and.Left)
+	var endJumps []int
+	for _, op := range and.Right {
+		endJumps = append(endJumps, c.emitJump(vm.OpJumpIfFalse))
+		c.emit(vm.OpPop)
+		c.compileComparison(op.Right)
+	}
+	for _, pos := range endJumps {
+		c.patchJump(pos)
+	}
+}
+
+func (c *FluxCompiler) compileComparison(cmp *ast.Comparison) {
+	c.compileAdditive(cmp.Left)
+	for _, op := range cmp.Right {
+		c.compileAdditive(op.Right)
+		c.emitOperator(op.Operator)
+	}
+}
+
+func (c *FluxCompiler) compileAdditive(add *ast.Additive) {
+	c.compileMultiplicative(add.Left)
+	for _, op := range add.Right {
+		c.compileMultiplicative(op.Right)
+		c.emitOperator(op.Operator)
+	}
+}
+
+func (c *FluxCompiler) compileMultiplicative(mul *ast.Multiplicative) {
+	c.compileUnary(mul.Left)
+	for _, op := range mul.Right {
+		c.compileUnary(op.Right)
+		c.emitOperator(op.Operator)
+	}
+}
+
+func (c *FluxCompiler) compileUnary(unary *ast.Unary) {
+	if n, ok := constantNumber(unary); ok {
+		c.emit(vm.OpConstant, c.addConstant(n)...)
+		return
+	}
+	if unary.Operator != nil {
+		c.compileUnary(unary.Operand)
+		switch *unary.Operator {
+		case "!":
+			c.emit(vm.OpNot)
+		case "-":
+			c.emit(vm.OpNegate)
+		}
+		return
+	}
+	c.compileExpr(&ast.Expr{Primary: unary.Primary})
+}
+
+// constantNumber folds a numeric literal with any number of minus signs in
+// front of it, such as -5, into its value.
+func constantNumber(unary *ast.Unary) (interface{}, bool) {
+	if unary.Operator != nil {
+		if *unary.Operator != "-" {
+			return nil, false
+		}
+		n, ok := constantNumber(unary.Operand)
+		if !ok {
+			return nil, false
+		}
+		return value.Negate(n), true
+	}
+	if unary.Primary.Base == nil || unary.Primary.Base.Term == nil || len(unary.Primary.Postfix) > 0 {
+		return nil, false
+	}
+	term := unary.Primary.Base.Term
+	switch {
+	case term.Number != nil:
+		return *term.Number, true
+	case term.Float != nil:
+		return *term.Float, true
+	}
+	return nil, false
+}
+
+func (c *FluxCompiler) emitOperator(operator string) {
+	switch operator {
+	case "+":
+		c.emit(vm.OpAdd)
+	case "-":
+		c.emit(vm.OpSub)
+	case "*":
+		c.emit(vm.OpMul)
+	case "/":
+		c.emit(vm.OpDiv)
+	case "%":
+		c.emit(vm.OpMod)
+	case "==":
+		c.emit(vm.OpEqual)
+	case "!=":
+		c.emit(vm.OpNotEqual)
+	case ">":
+		c.emit(vm.OpGreater)
+	case ">=":
+		c.emit(vm.OpGreaterEqual)
+	case "<":
+		c.emit(vm.OpLess)
+	case "<=":
+		c.emit(vm.OpLessEqual)
+	}
+}
+
+// compileInterpolation pushes the literal text and embedded expressions of
+// an interpolated string and joins them with a single OpConcat, which
+// stringifies each part.
+func (c *FluxCompiler) compileInterpolation(interp *ast.Interpolation) {
+	texts, exprs := interp.Fragments()
+	parts := 0
+	for i, text := range texts {
+		if text != "" {
+			c.emit(vm.OpConstant, c.addConstant(text)...)
+			parts++
+		}
+		if i < len(exprs) {
+			c.compileExpr(exprs[i])
+			parts++
+		}
+	}
+	c.emit(vm.OpConcat, c.operand(parts, "parts in an interpolated string"))
+}
+
+// compileIdent emits the load for a variable reference, preferring the
+// innermost binding: a local slot, then a captured upvalue, then a global.
+func (c *FluxCompiler) compileIdent(name string) {
+	if slot := c.scope.resolveLocal(name); slot != -1 {
+		c.emit(vm.OpGetLocal, byte(slot))
+		return
+	}
+	if idx := c.scope.resolveUpvalue(name); idx != -1 {
+		c.emit(vm.OpGetUpvalue, byte(idx))
+		return
+	}
+	c.emit(vm.OpGetGlobal, c.addConstant(name)...)
 }
 
 func (c *FluxCompiler) emit(op vm.Opcode, operands ...byte) {
@@ -206,7 +890,61 @@ func (c *FluxCompiler) emit(op vm.Opcode, operands ...byte) {
 	c.chunk.Code = append(c.chunk.Code, operands...)
 }
 
-func (c *FluxCompiler) addConstant(val interface{}) int {
+// emitJump emits a jump with a placeholder 16-bit offset and returns the
+// offset's position so it can be filled in by patchJump.
+func (c *FluxCompiler) emitJump(op vm.Opcode, operands ...byte) int {
+	c.emit(op, append(operands, 0, 0)...)
+	return len(c.chunk.Code) - 2
+}
+
+// patchJump points the jump whose offset is at pos to the current end of
+// the code.
+func (c *FluxCompiler) patchJump(pos int) {
+	offset := len(c.chunk.Code) - (pos + 2)
+	if offset > 0xffff {
+		c.reportError("too much code to jump over")
+	}
+	c.chunk.Code[pos] = byte(offset >> 8)
+	c.chunk.Code[pos+1] = byte(offset)
+}
+
+// emitLoop emits a backward jump to start.
+func (c *FluxCompiler) emitLoop(start int) {
+	offset := len(c.chunk.Code) + 3 - start
+	if offset > 0xffff {
+		c.reportError("loop body too large")
+	}
+	c.emit(vm.OpLoop, byte(offset>>8), byte(offset))
+}
+
+// addConstant adds val to the constants of the current chunk and returns
+// its index as a 16-bit big-endian operand.
+func (c *FluxCompiler) addConstant(val interface{}) []byte {
 	c.chunk.Constants = append(c.chunk.Constants, val)
-	return len(c.chunk.Constants) - 1
+	idx := len(c.chunk.Constants) - 1
+	if idx > 0xffff {
+		c.reportError("too many constants in one function")
+	}
+	return []byte{byte(idx >> 8), byte(idx)}
+}
+
+// operand returns n as a one-byte operand, reporting an error if it does
+// not fit. what names the things being counted.
+func (c *FluxCompiler) operand(n int, what string) byte {
+	if n > 0xff {
+		c.reportError("too many " + what)
+	}
+	return byte(n)
+}
+
+// checkFrame reports a function, or the script, that has more local slots
+// or captured variables than one-byte operands can address. Slots go up to
+// 254 so that the number of locals in use also fits in a byte.
+func (c *FluxCompiler) checkFrame(chunk *vm.Chunk) {
+	if chunk.NumLocals > 0xff {
+		c.reportError("too many local variables in one function")
+	}
+	if len(chunk.Upvalues) > 0x100 {
+		c.reportError("too many captured variables in one function")
+	}
 }
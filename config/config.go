@@ -11,6 +11,7 @@ import (
 type FluxConfig struct {
 	TypeChecking TypeCheckingConfig `json:"typeChecking"`
 	Compiler     CompilerConfig     `json:"compiler"`
+	Runtime      RuntimeConfig      `json:"runtime"`
 }
 
 // TypeCheckingConfig controls type checking behavior
@@ -26,6 +27,13 @@ type CompilerConfig struct {
 	Debug             bool `json:"debug"`
 }
 
+// RuntimeConfig controls how programs run
+type RuntimeConfig struct {
+	// Print the value of each top-level expression statement, as a REPL
+	// would
+	Echo bool `json:"echo"`
+}
+
 // DefaultConfig returns the default configuration
 func DefaultConfig() *FluxConfig {
 	return &FluxConfig{
@@ -38,6 +46,9 @@ func DefaultConfig() *FluxConfig {
 			OptimizationLevel: 1,
 			Debug:             false,
 		},
+		Runtime: RuntimeConfig{
+			Echo: false,
+		},
 	}
 }
 
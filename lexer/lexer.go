@@ -2,16 +2,39 @@ package lexer
 
 import "github.com/alecthomas/participle/v2/lexer"
 
-var LexerRules = lexer.MustSimple([]lexer.SimpleRule{
-	{Name: "SingleLineComment", Pattern: `//[^\n]*`},
-	{Name: "MultiLineComment", Pattern: `/\*[^*]*\*+(?:[^/*][^*]*\*+)*/`},
-	{Name: "Arrow", Pattern: `=>`},
-	{Name: "TypeArrow", Pattern: `->`},
-	{Name: "Keywords", Pattern: `\b(if|then|else|let|fn|int|string|bool|void)\b`},
-	{Name: "Bool", Pattern: `\b(true|false|yes|no)\b`},
-	{Name: "String", Pattern: `"[^"]*"`},
-	{Name: "Int", Pattern: `\d+`},
-	{Name: "Ident", Pattern: `[a-zA-Z_][a-zA-Z0-9_]*`},
-	{Name: "Operators", Pattern: `==|[+\-*/%<>=!&|(){}\[\],:]`},
-	{Name: "Whitespace", Pattern: `[ \t\n\r]+`},
+// stringBody matches the characters of a double-quoted string up to, but not
+// including, its closing quote or the ${ of an interpolation.
+const stringBody = `(?:[^"\\$]|\\.|\$(?:[^{"\\]|\\.))*`
+
+// LexerRules tokenizes Flux source. Interpolated strings ("a ${x} b") are
+// split into InterpStart, InterpMid and InterpEnd tokens around the embedded
+// expressions, which are lexed with the Root rules. Braces inside an
+// embedded expression are tracked so that only the matching } ends it.
+var LexerRules = lexer.MustStateful(lexer.Rules{
+	"Root": {
+		{Name: "SingleLineComment", Pattern: `//[^\n]*`},
+		{Name: "MultiLineComment", Pattern: `/\*[^*]*\*+(?:[^/*][^*]*\*+)*/`},
+		{Name: "Arrow", Pattern: `=>`},
+		{Name: "TypeArrow", Pattern: `->`},
+		{Name: "Keywords", Pattern: `\b(if|then|else|let|var|type|fn|while|for|in|break|continue|match|try|catch|int|float|string|bool|void)\b`},
+		{Name: "Bool", Pattern: `\b(true|false|yes|no)\b`},
+		{Name: "InterpStart", Pattern: `"` + stringBody + `\$\{`, Action: lexer.Push("Interp")},
+		{Name: "String", Pattern: `r"""(?s:.*?)"""|r"[^"]*"|"""(?s:(?:[^\\]|\\.)*?)"""|"` + stringBody + `\$?"`},
+		{Name: "Float", Pattern: `\d+\.\d+(?:[eE][+-]?\d+)?|\d+[eE][+-]?\d+`},
+		{Name: "Int", Pattern: `\d+`},
+		{Name: "Ident", Pattern: `[a-zA-Z_][a-zA-Z0-9_]*`},
+		{Name: "Operators", Pattern: `==|!=|<=|>=|&&|\|\||\|>|\.\.\.|\.\.|[+\-*/%<>=!&|(){}\[\],:.]`},
+		{Name: "Whitespace", Pattern: `[ \t\n\r]+`},
+	},
+	"Interp": {
+		{Name: "InterpEnd", Pattern: `\}` + stringBody + `\$?"`, Action: lexer.Pop()},
+		{Name: "InterpMid", Pattern: `\}` + stringBody + `\$\{`},
+		{Name: "NestedOpen", Pattern: `\{`, Action: lexer.Push("Nested")},
+		lexer.Include("Root"),
+	},
+	"Nested": {
+		{Name: "NestedClose", Pattern: `\}`, Action: lexer.Pop()},
+		{Name: "NestedOpen", Pattern: `\{`, Action: lexer.Push("Nested")},
+		lexer.Include("Root"),
+	},
 })
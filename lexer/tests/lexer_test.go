@@ -103,6 +103,63 @@ func TestLexer(t *testing.T) {
 				{Type: symbols["Operators"], Value: "}"},
 			},
 		},
+		{
+			name:  "String forms",
+			input: `"a \"b\"" """x""" r"\d"`,
+			expected: []lexer.Token{
+				{Type: symbols["String"], Value: `"a \"b\""`},
+				{Type: symbols["Whitespace"], Value: " "},
+				{Type: symbols["String"], Value: `"""x"""`},
+				{Type: symbols["Whitespace"], Value: " "},
+				{Type: symbols["String"], Value: `r"\d"`},
+			},
+		},
+		{
+			name:  "Interpolated string",
+			input: `"a ${x} b ${d["k"]}!"`,
+			expected: []lexer.Token{
+				{Type: symbols["InterpStart"], Value: `"a ${`},
+				{Type: symbols["Ident"], Value: "x"},
+				{Type: symbols["InterpMid"], Value: `} b ${`},
+				{Type: symbols["Ident"], Value: "d"},
+				{Type: symbols["Operators"], Value: "["},
+				{Type: symbols["String"], Value: `"k"`},
+				{Type: symbols["Operators"], Value: "]"},
+				{Type: symbols["InterpEnd"], Value: `}!"`},
+			},
+		},
+		{
+			name:  "Float literals",
+			input: "3.14 1e-3 2.5E2 42",
+			expected: []lexer.Token{
+				{Type: symbols["Float"], Value: "3.14"},
+				{Type: symbols["Whitespace"], Value: " "},
+				{Type: symbols["Float"], Value: "1e-3"},
+				{Type: symbols["Whitespace"], Value: " "},
+				{Type: symbols["Float"], Value: "2.5E2"},
+				{Type: symbols["Whitespace"], Value: " "},
+				{Type: symbols["Int"], Value: "42"},
+			},
+		},
+		{
+			name:  "Pipe and variadic operators",
+			input: "xs |> f(...ys) || b",
+			expected: []lexer.Token{
+				{Type: symbols["Ident"], Value: "xs"},
+				{Type: symbols["Whitespace"], Value: " "},
+				{Type: symbols["Operators"], Value: "|>"},
+				{Type: symbols["Whitespace"], Value: " "},
+				{Type: symbols["Ident"], Value: "f"},
+				{Type: symbols["Operators"], Value: "("},
+				{Type: symbols["Operators"], Value: "..."},
+				{Type: symbols["Ident"], Value: "ys"},
+				{Type: symbols["Operators"], Value: ")"},
+				{Type: symbols["Whitespace"], Value: " "},
+				{Type: symbols["Operators"], Value: "||"},
+				{Type: symbols["Whitespace"], Value: " "},
+				{Type: symbols["Ident"], Value: "b"},
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -16,12 +16,18 @@ import (
 	"github.com/pranavms13/flux-lang/parser"
 	"github.com/pranavms13/flux-lang/runtime"
 	"github.com/pranavms13/flux-lang/types"
+	"github.com/pranavms13/flux-lang/value"
 	"github.com/pranavms13/flux-lang/vm"
 )
 
 func init() {
 	// Register types for gob encoding
 	gob.Register(&vm.Chunk{})
+	gob.Register(&vm.Pattern{})
+	gob.Register(&value.RecordDecl{})
+	gob.Register(&value.VariantDecl{})
+	gob.Register(&value.Variant{})
+	gob.Register([]string{})
 	gob.Register([]interface{}{})
 	gob.Register(map[string]interface{}{})
 }
@@ -32,12 +38,20 @@ import (
 	"bytes"
 	"encoding/base64"
 	"encoding/gob"
+	"fmt"
+	"os"
 
+	"github.com/pranavms13/flux-lang/value"
 	"github.com/pranavms13/flux-lang/vm"
 )
 
 func init() {
 	gob.Register(&vm.Chunk{})
+	gob.Register(&vm.Pattern{})
+	gob.Register(&value.RecordDecl{})
+	gob.Register(&value.VariantDecl{})
+	gob.Register(&value.Variant{})
+	gob.Register([]string{})
 	gob.Register([]interface{}{})
 	gob.Register(map[string]interface{}{})
 }
@@ -56,7 +70,10 @@ func main() {
 	}
 
 	// Execute the bytecode
-	vm.New(&chunk).Run()
+	if err := vm.New(&chunk).Run(); err != nil {
+		fmt.Printf("Runtime error: %v\n", err)
+		os.Exit(1)
+	}
 }
 `
 
@@ -122,7 +139,13 @@ func main() {
 		}
 
 		// Step 3: Compile to bytecode
-		chunk := compiler.NewFluxCompiler().Compile(prog)
+		chunk, err := compiler.NewFluxCompilerWithConfig(compiler.Config{
+			Echo: cfg.Runtime.Echo,
+		}).Compile(prog)
+		if err != nil {
+			fmt.Println("Compile error:", err)
+			os.Exit(1)
+		}
 
 		// Step 4: Create temporary file for bytecode
 		tempFile, err := os.CreateTemp("", "flux-bytecode-*.gob")
@@ -242,7 +265,13 @@ func main() {
 		}
 
 		// Step 3: Run
-		runtime.Run(prog)
+		if err := runtime.RunWithConfig(prog, runtime.Config{
+			Out:  os.Stdout,
+			Echo: cfg.Runtime.Echo,
+		}); err != nil {
+			fmt.Printf("Runtime error: %v\n", err)
+			os.Exit(1)
+		}
 	case "init":
 		// Initialize a new Flux project with default configuration
 		if err := initializeProject(); err != nil {
@@ -2,15 +2,20 @@ package parser
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
 
 	"github.com/alecthomas/participle/v2"
+	participlelexer "github.com/alecthomas/participle/v2/lexer"
 	"github.com/pranavms13/flux-lang/ast"
 	"github.com/pranavms13/flux-lang/lexer"
 )
 
 var parserInstance = participle.MustBuild[ast.Program](
 	participle.Lexer(lexer.LexerRules),
-	participle.Unquote("String"),
+	participle.Map(unquoteString, "String"),
+	participle.Map(unquoteInterpolation, "InterpStart", "InterpMid", "InterpEnd"),
 	participle.Elide("Whitespace", "SingleLineComment", "MultiLineComment"),
 	participle.UseLookahead(5),
 	participle.CaseInsensitive("Keywords"),
@@ -23,3 +28,106 @@ func Parse(input string) (*ast.Program, error) {
 	}
 	return prog, nil
 }
+
+// unquoteString replaces a String token with the text it denotes. Regular
+// ("...") and triple-quoted ("""...""") strings process escape sequences;
+// raw strings (r"..." and r"""...""") are taken verbatim. Errors point at
+// the offending character inside the literal.
+func unquoteString(token participlelexer.Token) (participlelexer.Token, error) {
+	text := token.Value
+	raw := strings.HasPrefix(text, "r")
+	text = strings.TrimPrefix(text, "r")
+	quote := `"`
+	if len(text) >= 6 && strings.HasPrefix(text, `"""`) {
+		quote = `"""`
+	}
+	body := text[len(quote) : len(text)-len(quote)]
+
+	if raw {
+		token.Value = body
+		return token, nil
+	}
+
+	pos := token.Pos
+	advance(&pos, token.Value[:len(token.Value)-len(text)+len(quote)])
+	value, err := unescape(body, pos, quote == `"""`)
+	if err != nil {
+		return token, err
+	}
+	token.Value = value
+	return token, nil
+}
+
+// unquoteInterpolation processes the escape sequences in the pieces of an
+// interpolated string. The quote, "}" and "${" delimiters are kept: a bare
+// piece of text such as "/" would otherwise be taken for an operator by the
+// grammar. ast.Interpolation.Fragments strips them.
+func unquoteInterpolation(token participlelexer.Token) (participlelexer.Token, error) {
+	opening, closing := token.Value[:1], `"`
+	if strings.HasSuffix(token.Value, "${") {
+		closing = "${"
+	}
+	body := token.Value[1 : len(token.Value)-len(closing)]
+
+	pos := token.Pos
+	advance(&pos, opening)
+	value, err := unescape(body, pos, false)
+	if err != nil {
+		return token, err
+	}
+	token.Value = opening + value + closing
+	return token, nil
+}
+
+// unescape processes the escape sequences in the body of a string literal
+// that starts at pos. \$ is accepted so that a literal "${" can be written.
+func unescape(body string, pos participlelexer.Position, multiline bool) (string, error) {
+	var out strings.Builder
+	for body != "" {
+		if body[0] != '\\' {
+			if body[0] == '\n' && !multiline {
+				return "", participle.Errorf(pos, `newline in string literal (use """ for multiline strings)`)
+			}
+			r, size := utf8.DecodeRuneInString(body)
+			out.WriteRune(r)
+			advance(&pos, body[:size])
+			body = body[size:]
+			continue
+		}
+
+		if strings.HasPrefix(body, `\$`) {
+			out.WriteByte('$')
+			advance(&pos, body[:2])
+			body = body[2:]
+			continue
+		}
+
+		r, multibyte, tail, err := strconv.UnquoteChar(body, '"')
+		if err != nil {
+			_, size := utf8.DecodeRuneInString(body[1:])
+			return "", participle.Errorf(pos, "invalid escape sequence %s in string", body[:1+size])
+		}
+		if multibyte || r < utf8.RuneSelf {
+			out.WriteRune(r)
+		} else {
+			// \xHH escapes denote raw bytes
+			out.WriteByte(byte(r))
+		}
+		advance(&pos, body[:len(body)-len(tail)])
+		body = tail
+	}
+	return out.String(), nil
+}
+
+// advance moves pos past text.
+func advance(pos *participlelexer.Position, text string) {
+	for _, r := range text {
+		if r == '\n' {
+			pos.Line++
+			pos.Column = 1
+		} else {
+			pos.Column++
+		}
+	}
+	pos.Offset += len(text)
+}
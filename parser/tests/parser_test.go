@@ -0,0 +1,84 @@
+package parser_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pranavms13/flux-lang/ast"
+	"github.com/pranavms13/flux-lang/parser"
+)
+
+// stringLiteral returns the value of a program consisting of a single
+// string literal.
+func stringLiteral(t *testing.T, prog *ast.Program) string {
+	t.Helper()
+	term := prog.Statements[0].Expr.AsPrimary().Base.Term
+	if term == nil || term.String == nil {
+		t.Fatalf("Expected a string literal")
+	}
+	return *term.String
+}
+
+func TestStringLiterals(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{name: "Plain", input: `"Flux"`, expected: "Flux"},
+		{name: "Escapes", input: `"a\tb\nc \"q\" \\"`, expected: "a\tb\nc \"q\" \\"},
+		{name: "Unicode escapes", input: `"\u2603 \x41"`, expected: "☃ A"},
+		{name: "Triple-quoted", input: "\"\"\"one\n\"two\"\\tthree\"\"\"", expected: "one\n\"two\"\tthree"},
+		{name: "Raw", input: `r"C:\new\table"`, expected: `C:\new\table`},
+		{name: "Raw triple-quoted", input: "r\"\"\"a\n\\n\"\"\"", expected: "a\n\\n"},
+		{name: "Empty", input: `""`, expected: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prog, err := parser.Parse(tt.input)
+			if err != nil {
+				t.Fatalf("Parse error: %v", err)
+			}
+			if got := stringLiteral(t, prog); got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestStringLiteralErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "Invalid escape",
+			input:    "let x = 1\nlet s = \"ok \\q\"",
+			expected: `<stdin>:2:13: invalid escape sequence \q in string`,
+		},
+		{
+			name:     "Invalid escape in interpolated string",
+			input:    `let s = "${1} \z"`,
+			expected: `<stdin>:1:15: invalid escape sequence \z in string`,
+		},
+		{
+			name:     "Newline in regular string",
+			input:    "let s = \"open\nclose\"",
+			expected: `<stdin>:1:14: newline in string literal (use """ for multiline strings)`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parser.Parse(tt.input)
+			if err == nil {
+				t.Fatalf("Expected a parse error")
+			}
+			if !strings.HasSuffix(err.Error(), tt.expected) {
+				t.Errorf("Expected error %q, got %q", tt.expected, err.Error())
+			}
+		})
+	}
+}
@@ -2,59 +2,192 @@ package runtime
 
 import (
 	"fmt"
+	"io"
+	"os"
+	"strings"
 
 	"github.com/pranavms13/flux-lang/ast"
+	"github.com/pranavms13/flux-lang/value"
 )
 
-type Value interface{}
+type Value = interface{}
 type BuiltinFunc func(args ...Value) Value
 
-var env = map[string]Value{}
+func (BuiltinFunc) String() string {
+	return "<fn>"
+}
+
+// Closure is a function value paired with the environment it was created in,
+// so the body can see the variables of every enclosing scope.
+type Closure struct {
+	Func *ast.FuncExpr
+	Env  *Environment
+}
+
+func (c *Closure) String() string {
+	return "<fn>"
+}
+
+func (c *Closure) Signature() *value.Signature {
+	return c.Func.Signature()
+}
+
+// Environment is a lexical scope. Lookups walk the parent chain up to the
+// global scope.
+type Environment struct {
+	values map[string]Value
+	parent *Environment
+}
+
+func NewEnvironment(parent *Environment) *Environment {
+	return &Environment{
+		values: make(map[string]Value),
+		parent: parent,
+	}
+}
+
+func (e *Environment) Define(name string, val Value) {
+	e.values[name] = val
+}
 
-func init() {
-	env["print"] = BuiltinFunc(func(args ...Value) Value {
-		if len(args) == 0 {
-			return nil
+// Assign updates an existing binding in the nearest scope that defines name.
+// It reports false if name is not defined.
+func (e *Environment) Assign(name string, val Value) bool {
+	for scope := e; scope != nil; scope = scope.parent {
+		if _, ok := scope.values[name]; ok {
+			scope.values[name] = val
+			return true
 		}
-		// Just return the last argument without printing
-		return args[len(args)-1]
-	})
+	}
+	return false
 }
 
-func Run(prog *ast.Program) {
-	for _, stmt := range prog.Statements {
-		runStatement(stmt)
+func (e *Environment) Lookup(name string) (Value, bool) {
+	if val, ok := e.values[name]; ok {
+		return val, true
 	}
+	if e.parent != nil {
+		return e.parent.Lookup(name)
+	}
+	return nil, false
 }
 
-func runStatement(stmt *ast.Statement) {
-	if stmt.Let != nil {
-		val := evalExpr(stmt.Let.Expr, nil)
-		env[stmt.Let.Name] = val
-	} else if stmt.Expr != nil {
-		// Check if this is a print call before evaluating
-		isPrint := false
-		if stmt.Expr.Primary != nil && stmt.Expr.Primary.Base != nil && stmt.Expr.Primary.Base.Term != nil && stmt.Expr.Primary.Base.Term.Ident != nil && *stmt.Expr.Primary.Base.Term.Ident == "print" {
-			if len(stmt.Expr.Primary.Postfix) > 0 && stmt.Expr.Primary.Postfix[0].Call != nil {
-				isPrint = true
+// Config controls where a program's output goes and whether the values of
+// top-level expression statements are echoed, as a REPL would show them.
+type Config struct {
+	Out  io.Writer
+	Echo bool
+}
+
+// Global environment, set up by RunWithConfig
+var env *Environment
+var config = Config{Out: os.Stdout}
+
+// Record types and sum type constructors declared by the program, by name
+var records = map[string]*value.RecordDecl{}
+var variants = map[string]*value.VariantDecl{}
+
+func newGlobals() *Environment {
+	globals := NewEnvironment(nil)
+	globals.Define("print", BuiltinFunc(func(args ...Value) Value {
+		value.Print(config.Out, args, false)
+		return nil
+	}))
+	globals.Define("println", BuiltinFunc(func(args ...Value) Value {
+		value.Print(config.Out, args, true)
+		return nil
+	}))
+	for name, fn := range value.Builtins {
+		globals.Define(name, BuiltinFunc(func(args ...Value) Value {
+			return fn(callValue, args)
+		}))
+	}
+	return globals
+}
+
+// Run executes the program, writing its output to standard output. A Flux
+// runtime error that no try expression catches stops execution and is
+// returned to the caller.
+func Run(prog *ast.Program) error {
+	return RunWithConfig(prog, Config{Out: os.Stdout})
+}
+
+// RunWithConfig executes the program with the given output and echo
+// settings.
+func RunWithConfig(prog *ast.Program, cfg Config) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(loopSignal); ok {
+				err = value.Errorf("break or continue outside of a loop")
+				return
+			}
+			rtErr, ok := r.(*value.Error)
+			if !ok {
+				panic(r)
 			}
+			err = rtErr
+		}
+	}()
+
+	if cfg.Out == nil {
+		cfg.Out = os.Stdout
+	}
+	config = cfg
+	env = newGlobals()
+	// Type declarations are visible throughout the program
+	records = map[string]*value.RecordDecl{}
+	variants = map[string]*value.VariantDecl{}
+	for _, stmt := range prog.Statements {
+		if stmt.Type != nil {
+			declareType(stmt.Type)
+		}
+	}
+	// So are named functions, which can call each other
+	for _, stmt := range prog.Statements {
+		if stmt.Fn != nil {
+			env.Define(stmt.Fn.Name, &Closure{Func: stmt.Fn.Func(), Env: env})
 		}
+	}
+	for _, stmt := range prog.Statements {
+		runStatement(stmt)
+	}
+	return nil
+}
 
-		// Check if this is an array indexing or dictionary access
-		isIndexing := false
-		if stmt.Expr.Primary != nil && len(stmt.Expr.Primary.Postfix) > 0 && stmt.Expr.Primary.Postfix[0].Index != nil {
-			isIndexing = true
+// declareType registers a record type, or defines the constructors of a sum
+// type as globals. A constructor without fields is bound to its only value.
+func declareType(decl *ast.TypeDecl) {
+	if decl.Record == nil {
+		for _, variant := range decl.Variants {
+			ctor := &value.VariantDecl{Type: decl.Name, Name: variant.Name, Arity: len(variant.Fields)}
+			variants[variant.Name] = ctor
+			if ctor.Arity == 0 {
+				env.Define(variant.Name, value.NewVariant(ctor, nil))
+			} else {
+				env.Define(variant.Name, ctor)
+			}
 		}
+		return
+	}
+	fields := make([]string, len(decl.Record.Fields))
+	for i, field := range decl.Record.Fields {
+		fields[i] = field.Name
+	}
+	records[decl.Name] = &value.RecordDecl{Name: decl.Name, Fields: fields}
+}
 
-		val := evalExpr(stmt.Expr, nil)
-		// Only print if it's not a print call and not an array indexing
-		if !isPrint && !isIndexing {
-			fmt.Println(val)
+func runStatement(stmt *ast.Statement) {
+	if stmt.Let != nil || stmt.Assign != nil || stmt.Type != nil || stmt.Fn != nil {
+		evalStatement(stmt, env)
+	} else if stmt.Expr != nil {
+		val := evalExpr(stmt.Expr, env)
+		if config.Echo && stmt.Expr.Echoed() {
+			fmt.Fprintln(config.Out, value.Format(val))
 		}
 	}
 }
 
-func evalExpr(expr *ast.Expr, local map[string]Value) Value {
+func evalExpr(expr *ast.Expr, local *Environment) Value {
 	switch {
 	case expr.If != nil:
 		cond := evalExpr(expr.If.Cond, local)
@@ -62,136 +195,293 @@ func evalExpr(expr *ast.Expr, local map[string]Value) Value {
 			return evalExpr(expr.If.ThenExpr, local)
 		}
 		return evalExpr(expr.If.ElseExpr, local)
-	case expr.Bin != nil:
-		left := evalExpr(&ast.Expr{Primary: expr.Bin.Left}, local)
-		if expr.Bin.Operator == nil || expr.Bin.Right == nil {
-			return left
-		}
-		right := evalExpr(expr.Bin.Right, local)
-		switch *expr.Bin.Operator {
-		case "+":
-			switch l := left.(type) {
-			case int:
-				return l + right.(int)
-			case string:
-				return l + right.(string)
-			default:
-				panic("unsupported + operands")
+	case expr.While != nil:
+		for truthy(evalExpr(expr.While.Cond, local)) {
+			if runIteration(expr.While.Body, local) {
+				break
 			}
-		case "-":
-			return left.(int) - right.(int)
-		case "==":
-			return left == right
-		case ">":
-			return left.(int) > right.(int)
-		case "<":
-			return left.(int) < right.(int)
-		default:
-			panic("unsupported operator: " + *expr.Bin.Operator)
 		}
+		return nil
+	case expr.For != nil:
+		evalFor(expr.For, local)
+		return nil
+	case expr.Match != nil:
+		return evalMatch(expr.Match, local)
+	case expr.Try != nil:
+		return evalTry(expr.Try, local)
+	case expr.Break:
+		panic(breakLoop)
+	case expr.Continue:
+		panic(continueLoop)
+	case expr.Bin != nil:
+		return evalBinary(expr.Bin, local)
 	case expr.Block != nil:
 		return evalBlock(expr.Block, local)
 	case expr.Primary != nil:
-		// Evaluate the base
-		var val Value
-		if expr.Primary.Base != nil {
-			if expr.Primary.Base.Term != nil {
-				val = evalTerm(expr.Primary.Base.Term, local)
-			} else if expr.Primary.Base.List != nil {
-				vals := []Value{}
-				for _, e := range expr.Primary.Base.List.Elems {
-					vals = append(vals, evalExpr(e, local))
-				}
-				val = vals
-			} else if expr.Primary.Base.Dict != nil {
-				dict := make(map[interface{}]interface{})
-				for _, pair := range expr.Primary.Base.Dict.Pairs {
-					key := evalExpr(pair.Key, local)
-					value := evalExpr(pair.Value, local)
-					dict[key] = value
+		return applyPostfix(evalBase(expr.Primary.Base, local), expr.Primary.Postfix, local)
+	case expr.Func != nil:
+		return &Closure{Func: expr.Func, Env: local}
+	default:
+		panic("unknown expression")
+	}
+}
+
+// evalBase evaluates the base of a primary expression, before any calls,
+// indexing or field accesses.
+func evalBase(base *ast.BaseExpr, local *Environment) Value {
+	var val Value
+	if base != nil {
+		if base.Record != nil {
+			val = evalRecord(base.Record, local)
+		} else if base.Term != nil {
+			val = evalTerm(base.Term, local)
+		} else if base.List != nil {
+			vals := []Value{}
+			for _, e := range base.List.Elems {
+				vals = append(vals, evalExpr(e, local))
+			}
+			val = vals
+		} else if paren := base.Paren; paren != nil {
+			if paren.IsTuple() {
+				tuple := value.Tuple{}
+				for _, e := range paren.Elems() {
+					tuple = append(tuple, evalExpr(e, local))
 				}
-				val = dict
+				val = tuple
+			} else {
+				val = evalExpr(paren.Expr, local)
 			}
+		} else if base.Dict != nil {
+			dict := make(map[interface{}]interface{})
+			for _, pair := range base.Dict.Pairs {
+				key := value.CheckKey(evalExpr(pair.Key, local))
+				value := evalExpr(pair.Value, local)
+				dict[key] = value
+			}
+			val = dict
 		}
-		// Apply postfixes
-		for _, pf := range expr.Primary.Postfix {
-			if pf.Call != nil {
-				// Function call
-				fnVal := val
-				var args []Value
-				for _, argExpr := range pf.Call.Args {
-					args = append(args, evalExpr(argExpr, local))
-				}
-				// If val is a string (function name), look up in env
-				if name, ok := fnVal.(string); ok {
-					fnVal, ok = env[name]
-					if !ok {
-						panic("undefined function: " + name)
-					}
-				}
-				if builtin, ok := fnVal.(BuiltinFunc); ok {
-					val = builtin(args...)
-				} else if funcExpr, ok := fnVal.(*ast.FuncExpr); ok {
-					if len(funcExpr.Params) != len(args) {
-						panic("argument count mismatch")
-					}
-					localEnv := make(map[string]Value)
-					for i, param := range funcExpr.Params {
-						localEnv[param.Name] = args[i]
-					}
-					val = evalExpr(funcExpr.Body, localEnv)
-				} else {
-					panic("not a function")
-				}
-			} else if pf.Index != nil {
-				indexVal := evalExpr(pf.Index.Index, local)
-				switch v := val.(type) {
-				case []Value:
-					// Array indexing
-					idx, ok := indexVal.(int)
-					if !ok {
-						panic("Array index must be an integer")
-					}
-					if idx < 0 || idx >= len(v) {
-						panic("Array index out of bounds")
-					}
-					val = v[idx]
-				case map[interface{}]interface{}:
-					// Dictionary access
-					value, exists := v[indexVal]
-					if !exists {
-						panic(fmt.Sprintf("Key not found in dictionary: %v", indexVal))
-					}
-					val = value
-				default:
-					panic(fmt.Sprintf("Cannot index into value of type %T", val))
-				}
+	}
+	return val
+}
+
+// applyPostfix applies the calls, indexing and field accesses of a primary
+// expression to the value of its base, from left to right.
+func applyPostfix(val Value, postfix []*ast.Postfix, local *Environment) Value {
+	for _, pf := range postfix {
+		if pf.Call != nil {
+			val = evalCall(val, pf.Call, nil, local)
+		} else if pf.Index != nil {
+			val = value.Index(val, evalExpr(pf.Index.Index, local))
+		} else if pf.Field != nil {
+			val = value.GetField(val, pf.Field.Name)
+		}
+	}
+	return val
+}
+
+// evalCall calls fnVal with the arguments of call, after the values in
+// leading, which a pipe uses to pass its value in first.
+func evalCall(fnVal Value, call *ast.CallExpr, leading []Value, local *Environment) Value {
+	args := leading
+	var names []string
+	if call != nil {
+		for _, arg := range call.Args {
+			args = append(args, evalExpr(arg.Value, local))
+		}
+		if names = call.ArgNames(); names != nil && len(leading) > 0 {
+			names = append(make([]string, len(leading)), names...)
+		}
+	}
+	// If fnVal is a string (function name), look up in env
+	if name, ok := fnVal.(string); ok {
+		fnVal, ok = env.Lookup(name)
+		if !ok {
+			panic(value.Errorf("undefined function: %s", name))
+		}
+	}
+	return callFunction(fnVal, args, names)
+}
+
+// evalBinary evaluates an || chain and passes its value through any pipes
+// after it. Evaluation of the chain stops at the first truthy operand, which
+// becomes the value of the whole chain.
+func evalBinary(bin *ast.Binary, local *Environment) Value {
+	left := evalLogicalAnd(bin.Left, local)
+	for _, op := range bin.Right {
+		if truthy(left) {
+			break
+		}
+		left = evalLogicalAnd(op.Right, local)
+	}
+	for _, pipe := range bin.Pipes {
+		left = evalPipe(pipe, left, local)
+	}
+	return left
+}
+
+// evalPipe calls the target of a pipe with piped as its first argument, as
+// Binary.Piped spells out, without building the call expression.
+func evalPipe(pipe *ast.PipeOp, piped Value, local *Environment) Value {
+	postfix := pipe.Target.Postfix
+	var call *ast.CallExpr
+	if n := len(postfix); n > 0 && postfix[n-1].Call != nil {
+		call = postfix[n-1].Call
+		postfix = postfix[:n-1]
+	}
+	fnVal := applyPostfix(evalBase(pipe.Target.Base, local), postfix, local)
+	return evalCall(fnVal, call, []Value{piped}, local)
+}
+
+// evalLogicalAnd evaluates an && chain. Evaluation stops at the first falsy
+// operand, which becomes the value of the whole chain.
+func evalLogicalAnd(and *ast.LogicalAnd, local *Environment) Value {
+	left := evalComparison(and.Left, local)
+	for _, op := range and.Right {
+		if !truthy(left) {
+			return left
+		}
+		left = evalComparison(op.Right, local)
+	}
+	return left
+}
+
+func evalComparison(cmp *ast.Comparison, local *Environment) Value {
+	left := evalAdditive(cmp.Left, local)
+	for _, op := range cmp.Right {
+		left = applyOperator(op.Operator, left, evalAdditive(op.Right, local))
+	}
+	return left
+}
+
+func evalAdditive(add *ast.Additive, local *Environment) Value {
+	left := evalMultiplicative(add.Left, local)
+	for _, op := range add.Right {
+		left = applyOperator(op.Operator, left, evalMultiplicative(op.Right, local))
+	}
+	return left
+}
+
+func evalMultiplicative(mul *ast.Multiplicative, local *Environment) Value {
+	left := evalUnary(mul.Left, local)
+	for _, op := range mul.Right {
+		left = applyOperator(op.Operator, left, evalUnary(op.Right, local))
+	}
+	return left
+}
+
+// callValue calls a function value with positional arguments. Builtins use
+// it to call back into the program.
+func callValue(fn interface{}, args ...interface{}) interface{} {
+	return callFunction(fn, args, nil)
+}
+
+// callFunction calls a function value. names holds the parameter name of
+// each argument, or "" for a positional one; only closures take named
+// arguments.
+func callFunction(fnVal Value, args []Value, names []string) Value {
+	switch fn := fnVal.(type) {
+	case BuiltinFunc:
+		value.PositionalOnly(names)
+		return fn(args...)
+	case *value.VariantDecl:
+		value.PositionalOnly(names)
+		return value.NewVariant(fn, args)
+	case *Closure:
+		values, given := fn.Func.Signature().Bind(args, names)
+		callEnv := NewEnvironment(fn.Env)
+		for i, param := range fn.Func.Params {
+			if !given[i] {
+				// Defaults can refer to the parameters before them
+				values[i] = evalExpr(param.Default, callEnv)
 			}
+			callEnv.Define(param.Name, values[i])
 		}
-		return val
-	case expr.Func != nil:
-		return expr.Func
+		return evalFunctionBody(fn.Func.Body, callEnv)
+	}
+	panic(value.Errorf("not a function"))
+}
+
+// evalFunctionBody evaluates the body of a closure. break and continue
+// cannot reach loops outside the function, so a loopSignal escaping the
+// body is an error rather than an exit from the caller's loop.
+func evalFunctionBody(body *ast.Expr, callEnv *Environment) Value {
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(loopSignal); ok {
+				panic(value.Errorf("break or continue outside of a loop"))
+			}
+			panic(r)
+		}
+	}()
+	return evalExpr(body, callEnv)
+}
+
+func evalUnary(unary *ast.Unary, local *Environment) Value {
+	if unary.Operator != nil {
+		operand := evalUnary(unary.Operand, local)
+		switch *unary.Operator {
+		case "!":
+			return !truthy(operand)
+		case "-":
+			return value.Negate(operand)
+		default:
+			panic("unsupported operator: " + *unary.Operator)
+		}
+	}
+	return evalExpr(&ast.Expr{Primary: unary.Primary}, local)
+}
+
+func applyOperator(operator string, left, right Value) Value {
+	switch operator {
+	case "+":
+		return value.Add(left, right)
+	case "-":
+		return value.Sub(left, right)
+	case "*":
+		return value.Mul(left, right)
+	case "/":
+		return value.Div(left, right)
+	case "%":
+		return value.Mod(left, right)
+	case "==":
+		return value.Equal(left, right)
+	case "!=":
+		return !value.Equal(left, right)
+	case "<":
+		return value.Compare(left, right) < 0
+	case "<=":
+		return value.Compare(left, right) <= 0
+	case ">":
+		return value.Compare(left, right) > 0
+	case ">=":
+		return value.Compare(left, right) >= 0
 	default:
-		panic("unknown expression")
+		panic("unsupported operator: " + operator)
 	}
 }
 
-func evalTerm(term *ast.Term, local map[string]Value) Value {
+func evalTerm(term *ast.Term, local *Environment) Value {
 	if term.Bool != nil {
-		return *term.Bool
+		return bool(*term.Bool)
+	} else if term.Float != nil {
+		return *term.Float
 	} else if term.Number != nil {
 		return *term.Number
 	} else if term.String != nil {
 		return *term.String
-	} else if term.Ident != nil {
-		if local != nil {
-			if val, ok := local[*term.Ident]; ok {
-				return val
-			}
+	} else if term.Interp != nil {
+		texts, exprs := term.Interp.Fragments()
+		var sb strings.Builder
+		for i, e := range exprs {
+			sb.WriteString(texts[i])
+			sb.WriteString(value.Format(evalExpr(e, local)))
 		}
-		val, ok := env[*term.Ident]
+		sb.WriteString(texts[len(texts)-1])
+		return sb.String()
+	} else if term.Ident != nil {
+		val, ok := local.Lookup(*term.Ident)
 		if !ok {
-			panic("undefined variable: " + *term.Ident)
+			panic(value.Errorf("undefined variable: %s", *term.Ident))
 		}
 		return val
 	}
@@ -204,6 +494,8 @@ func truthy(val Value) bool {
 		return v
 	case int:
 		return v != 0
+	case float64:
+		return v != 0
 	case string:
 		return v != ""
 	default:
@@ -211,13 +503,263 @@ func truthy(val Value) bool {
 	}
 }
 
-func evalBlock(block *ast.BlockExpr, local map[string]Value) Value {
+// loopSignal is raised by break and continue and recovered by the innermost
+// enclosing loop.
+type loopSignal int
+
+const (
+	breakLoop loopSignal = iota
+	continueLoop
+)
+
+// runIteration evaluates one pass of a loop body and reports whether the
+// body executed break.
+func runIteration(body *ast.BlockExpr, scope *Environment) (broke bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			signal, ok := r.(loopSignal)
+			if !ok {
+				panic(r)
+			}
+			broke = signal == breakLoop
+		}
+	}()
+	evalBlock(body, scope)
+	return false
+}
+
+// evalTry evaluates the body of a try expression. A runtime error raised
+// anywhere inside it, including in functions it calls, is passed to the
+// handler; errors raised by the handler itself propagate.
+func evalTry(try *ast.TryExpr, local *Environment) Value {
+	var result Value
+	caught := func() (caught *value.Error) {
+		defer func() {
+			if r := recover(); r != nil {
+				rtErr, ok := r.(*value.Error)
+				if !ok {
+					panic(r)
+				}
+				caught = rtErr
+			}
+		}()
+		result = evalBlock(try.Body, local)
+		return nil
+	}()
+	if caught == nil {
+		return result
+	}
+	scope := NewEnvironment(local)
+	scope.Define(try.Var, caught)
+	return evalBlock(try.Handler, scope)
+}
+
+// evalFor runs the body of a for loop with the loop variable bound to each
+// element in a fresh scope, so closures capture the value of their own
+// iteration.
+func evalFor(loop *ast.ForExpr, local *Environment) {
+	iteration := func(item Value) bool {
+		scope := NewEnvironment(local)
+		scope.Define(loop.Var, item)
+		return runIteration(loop.Body, scope)
+	}
+
+	if loop.RangeEnd != nil {
+		start, end := value.RangeBounds(evalExpr(loop.Iter, local), evalExpr(loop.RangeEnd, local))
+		for i := start; i < end; i++ {
+			if iteration(i) {
+				return
+			}
+		}
+		return
+	}
+	for _, item := range value.Iterate(evalExpr(loop.Iter, local)) {
+		if iteration(item) {
+			return
+		}
+	}
+}
+
+// evalMatch evaluates the first arm that matches. Each arm binds its
+// pattern variables in a scope of its own.
+func evalMatch(match *ast.MatchExpr, local *Environment) Value {
+	val := evalExpr(match.Value, local)
+	for _, arm := range match.Arms {
+		scope := NewEnvironment(local)
+		if !matchPattern(arm.Pattern, val, scope) {
+			continue
+		}
+		if arm.Guard != nil && !truthy(evalExpr(arm.Guard, scope)) {
+			continue
+		}
+		return evalExpr(arm.Body, scope)
+	}
+	panic(value.Errorf("no match arm for value: %s", value.Format(val)))
+}
+
+// matchPattern reports whether val matches pattern, defining the pattern's
+// bindings in scope as it goes.
+func matchPattern(pattern *ast.Pattern, val Value, scope *Environment) bool {
+	switch {
+	case pattern.Literal != nil:
+		return value.Equal(pattern.Literal.Value(), val)
+	case pattern.Constructor != nil:
+		return matchVariant(pattern.Constructor.Name, pattern.Constructor.Args, val, scope)
+	case pattern.Binding != nil:
+		if _, ok := variants[*pattern.Binding]; ok {
+			return matchVariant(*pattern.Binding, nil, val, scope)
+		}
+		if !pattern.IsWildcard() {
+			scope.Define(*pattern.Binding, val)
+		}
+		return true
+	case pattern.List != nil:
+		list, ok := val.([]Value)
+		if !ok {
+			return false
+		}
+		elems := pattern.List.Elems
+		if len(list) < len(elems) || (pattern.List.Rest == nil && len(list) != len(elems)) {
+			return false
+		}
+		for i, elem := range elems {
+			if !matchPattern(elem, list[i], scope) {
+				return false
+			}
+		}
+		if rest := pattern.List.Rest; rest != nil && rest.Name != nil && *rest.Name != "_" {
+			scope.Define(*rest.Name, append([]Value{}, list[len(elems):]...))
+		}
+		return true
+	case pattern.Tuple != nil:
+		tuple, ok := val.(value.Tuple)
+		if !ok || len(tuple) != len(pattern.Tuple.Elems) {
+			return false
+		}
+		for i, elem := range pattern.Tuple.Elems {
+			if !matchPattern(elem, tuple[i], scope) {
+				return false
+			}
+		}
+		return true
+	case pattern.Dict != nil:
+		dict, ok := val.(map[interface{}]interface{})
+		if !ok {
+			return false
+		}
+		for _, entry := range pattern.Dict.Entries {
+			elem, exists := dict[entry.Key.Value()]
+			if !exists || !matchPattern(entry.Value, elem, scope) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// matchVariant matches a value built by the named constructor, matching its
+// arguments against args.
+func matchVariant(name string, args []*ast.Pattern, val Value, scope *Environment) bool {
+	ctor, ok := variants[name]
+	if !ok {
+		panic(value.Errorf("unknown constructor: %s", name))
+	}
+	if !ctor.Builds(val) {
+		return false
+	}
+	fields := val.(*value.Variant).Values
+	if len(fields) != len(args) {
+		return false
+	}
+	for i, arg := range args {
+		if !matchPattern(arg, fields[i], scope) {
+			return false
+		}
+	}
+	return true
+}
+
+// evalStatement executes a statement in scope. Lets, assignments and
+// declarations evaluate to void; an expression evaluates to its value.
+func evalStatement(stmt *ast.Statement, scope *Environment) Value {
+	if stmt.Let != nil {
+		val := evalExpr(stmt.Let.Expr, scope)
+		if stmt.Let.Pattern == nil {
+			scope.Define(stmt.Let.Name, val)
+		} else if !matchPattern(stmt.Let.Pattern, val, scope) {
+			panic(value.Errorf("let pattern does not match value: %s", value.Format(val)))
+		}
+		return nil
+	}
+	if stmt.Assign != nil {
+		evalAssign(stmt.Expr, stmt.Assign, scope)
+		return nil
+	}
+	if stmt.Type != nil || stmt.Fn != nil {
+		// Declared before the program runs
+		return nil
+	}
+	return evalExpr(stmt.Expr, scope)
+}
+
+// evalAssign stores the value of rhs in target: a variable, an indexing
+// expression such as xs[i] or d["k"], or a record field such as user.name.
+func evalAssign(target, rhs *ast.Expr, scope *Environment) {
+	primary := target.AsPrimary()
+	if primary == nil || primary.Base == nil {
+		panic(value.Errorf("invalid assignment target"))
+	}
+	if len(primary.Postfix) == 0 {
+		if primary.Base.Term == nil || primary.Base.Term.Ident == nil {
+			panic(value.Errorf("invalid assignment target"))
+		}
+		name := *primary.Base.Term.Ident
+		if !scope.Assign(name, evalExpr(rhs, scope)) {
+			panic(value.Errorf("undefined variable: %s", name))
+		}
+		return
+	}
+
+	last := primary.Postfix[len(primary.Postfix)-1]
+	if last.Call != nil {
+		panic(value.Errorf("invalid assignment target"))
+	}
+	container := evalExpr(&ast.Expr{Primary: &ast.PrimaryExpr{
+		Base:    primary.Base,
+		Postfix: primary.Postfix[:len(primary.Postfix)-1],
+	}}, scope)
+	if last.Field != nil {
+		value.SetField(container, last.Field.Name, evalExpr(rhs, scope))
+		return
+	}
+	index := evalExpr(last.Index.Index, scope)
+	value.SetIndex(container, index, evalExpr(rhs, scope))
+}
+
+func evalRecord(lit *ast.RecordLit, local *Environment) Value {
+	decl, ok := records[lit.Name]
+	if !ok {
+		panic(value.Errorf("unknown type: %s", lit.Name))
+	}
+	names := make([]string, len(lit.Fields))
+	values := make([]Value, len(lit.Fields))
+	for i, field := range lit.Fields {
+		names[i] = field.Name
+		values[i] = evalExpr(field.Value, local)
+	}
+	return value.NewRecord(decl, names, values)
+}
+
+func evalBlock(block *ast.BlockExpr, local *Environment) Value {
 	if block == nil {
 		return nil
 	}
+	// Bindings made inside the block go out of scope when it ends
+	scope := NewEnvironment(local)
 	var result Value
-	for _, expr := range block.Exprs {
-		result = evalExpr(expr, local)
+	for _, stmt := range block.Statements {
+		result = evalStatement(stmt, scope)
 	}
 	return result
 }
@@ -0,0 +1,750 @@
+package runtime_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/pranavms13/flux-lang/parser"
+	"github.com/pranavms13/flux-lang/runtime"
+)
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []string
+		err      string
+	}{
+		{
+			name: "Curried closure",
+			input: `let adder = fn(x) => fn(y) => x + y
+adder(1)(2)
+let add5 = adder(5)
+add5(10)`,
+			expected: []string{"3", "15"},
+		},
+		{
+			name: "Closure over several scopes",
+			input: `let three = fn(a) => fn(b) => fn(c) => a + b + c
+three("a")("b")("c")`,
+			expected: []string{"abc"},
+		},
+		{
+			name: "Callbacks",
+			input: `let compose = fn(f, g) => fn(x) => f(g(x))
+let inc = fn(x) => x + 1
+let twice = fn(f) => fn(x) => f(f(x))
+compose(inc, twice(inc))(10)`,
+			expected: []string{"13"},
+		},
+		{
+			name: "Multiplication, division and modulo",
+			input: `7 * 6
+7 / 2
+7 % 3`,
+			expected: []string{"42", "3", "1"},
+		},
+		{
+			name: "Operator precedence and associativity",
+			input: `10 - 3 - 2
+100 / 10 / 5
+2 + 3 * 4
+let grouped = (2 + 3) * 4
+grouped
+1 + 2 == 3`,
+			expected: []string{"5", "2", "14", "20", "true"},
+		},
+		{
+			name: "Logical operators short-circuit",
+			input: `let boom = fn() => 1 / 0
+true || boom()
+false && boom()
+1 < 2 && 3 > 2
+!(1 > 2) && !false
+let inRange = fn(x) => x > 0 && x < 10
+inRange(5) || boom()
+if false then "then" else "else"`,
+			expected: []string{"true", "false", "true", "true", "true", "else"},
+		},
+		{
+			name: "Comparison operators",
+			input: `1 != 2
+3 <= 3
+2 >= 3
+"apple" < "banana"
+"b" >= "a"
+[1, 2] == [1, 2]
+{"a": 1} != {"a": 2}`,
+			expected: []string{"true", "true", "false", "true", "true", "true", "true"},
+		},
+		{
+			name:     "Ordering mismatched types",
+			input:    `1 < "a"`,
+			expected: []string{""},
+			err:      "cannot compare int and string",
+		},
+		{
+			name: "Float arithmetic",
+			input: `let pi: float = 3.14
+pi * 2.0
+1e-3
+let scores = [90.0, 75.5, 88.0]
+let avg = (scores[0] + scores[1] + scores[2]) / 3.0
+avg
+1 + 0.5
+10 / 4
+1 == 1.0`,
+			expected: []string{"6.28", "0.001", "84.5", "1.5", "2", "true"},
+		},
+		{
+			name: "String interpolation",
+			input: `let name = "Ada"
+let age = 36
+"Hello, ${name}, you are ${age + 1}"
+let d = {"k": [1, 2]}
+"dict ${d}, first ${d["k"][0]}, ${1.5 * 2.0}, ${true}"
+"nested ${"inner ${name}"} and literal \${name}"
+"${age}/${age + 1}"`,
+			expected: []string{
+				"Hello, Ada, you are 37",
+				`dict {"k": [1, 2]}, first 1, 3.0, true`,
+				"nested inner Ada and literal ${name}",
+				"36/37",
+			},
+		},
+		{
+			name: "Local let in blocks",
+			input: `let x = 10
+let f = fn(a) => {
+  let b = a * 2
+  let c = {
+    let x = b + 1
+    x * 10
+  }
+  c + x
+}
+f(3)
+let counter = {
+  let start = 5
+  fn(k) => start + k
+}
+counter(1)
+{ let unused = 1 }
+x`,
+			expected: []string{"80", "6", "void", "10"},
+		},
+		{
+			name: "Mutable variables and assignment",
+			input: `var count = 0
+count = count + 1
+count
+var xs = [1, 2, 3]
+xs[0] = 10
+var d = {"a": 1}
+d["b"] = 2
+d["a"] = d["a"] + 5
+[xs, d]
+let bump = fn() => {
+  count = count + 10
+  count
+}
+bump()
+let makeCounter = fn() => {
+  var n = 0
+  fn() => {
+    n = n + 1
+    n
+  }
+}
+let next = makeCounter()
+next()
+next()
+var grid = [[1, 2], [3, 4]]
+grid[1][0] = 30
+grid`,
+			expected: []string{"1", `[[10, 2, 3], {"a": 6, "b": 2}]`, "11", "1", "2", "[[1, 2], [30, 4]]"},
+		},
+		{
+			name:     "Assigning past the end of a list",
+			input:    "var xs = [1]\nxs[1] = 2",
+			expected: []string{""},
+			err:      "list index 1 out of range for length 1",
+		},
+		{
+			name: "Loops",
+			input: `var total = 0
+for x in [1, 2, 3, 4] {
+  total = total + x
+}
+total
+var i = 0
+var odds = [0, 0, 0, 0]
+while i < 10 {
+  i = i + 1
+  if i % 2 == 0 then continue else 0
+  if i > 7 then break else 0
+  odds[i / 2] = i
+}
+odds
+var keys = ""
+for k in {"b": 2, "a": 1, "c": 3} {
+  keys = keys + k
+}
+keys
+var sum = 0
+for n in 0..5 {
+  sum = sum + n
+}
+sum
+let nested = fn(xs) => {
+  var acc = 0
+  for x in xs {
+    for y in xs {
+      if y > x then break else 0
+      acc = acc + y
+    }
+  }
+  acc
+}
+nested([1, 2, 3])`,
+			expected: []string{"10", "[1, 3, 5, 7]", "abc", "10", "10"},
+		},
+		{
+			name: "Closures capture each loop iteration",
+			input: `var fs = [0, 0, 0]
+for n in 0..3 {
+  let m = n * 10
+  fs[n] = fn() => m + n
+}
+[fs[0](), fs[1](), fs[2]()]`,
+			expected: []string{"[0, 11, 22]"},
+		},
+		{
+			name:     "Loop body longer than a byte of jump",
+			input:    "var n = 0\nwhile n < 3 {\n" + strings.Repeat("n = n + 0\n", 40) + "n = n + 1\n}\nn",
+			expected: []string{"3"},
+		},
+		{
+			name:     "Iterating over a non-collection",
+			input:    `for c in 5 { c }`,
+			expected: []string{""},
+			err:      "cannot iterate over int",
+		},
+		{
+			name: "Match expressions",
+			input: `let describe = fn(n) => match n {
+  0 => "zero",
+  1 => "one",
+  x if x < 0 => "negative",
+  _ => "many"
+}
+[describe(0), describe(1), describe(0 - 5), describe(7)]
+let shape = fn(xs) => match xs {
+  [] => "empty",
+  [a] => "one ${a}",
+  [a, b] => "pair ${a}/${b}",
+  [first, ..rest] => "${first} then ${rest}",
+}
+[shape([]), shape([1]), shape([1, 2]), shape([1, 2, 3])]
+let user = {"name": "Ada", "role": "admin"}
+match user {
+  {"role": "admin", "name": n} => "admin ${n}",
+  {"name": n} => "user ${n}"
+}
+var total = 0
+var rest = [1, 2, 3]
+while true {
+  match rest {
+    [] => break,
+    [h, ..t] => {
+      total = total + h
+      rest = t
+    }
+  }
+}
+total
+let add = match 5 { k => fn(z) => k + z }
+add(1)`,
+			expected: []string{
+				`["zero", "one", "negative", "many"]`,
+				`["empty", "one 1", "pair 1/2", "1 then [2, 3]"]`,
+				"admin Ada",
+				"6",
+				"6",
+			},
+		},
+		{
+			name:     "No matching arm",
+			input:    `match 9 { 1 => "one", 2 => "two" }`,
+			expected: []string{""},
+			err:      "no match arm for value: 9",
+		},
+		{
+			name: "Records",
+			input: `type User = {name: string, age: int}
+let ada = User {name: "Ada", age: 36}
+ada
+ada.name
+var bob = User {age: 40, name: "Bob"}
+bob.age = bob.age + 1
+[bob.age, bob.name]
+ada == User {name: "Ada", age: 36}
+ada == bob
+let team = {"lead": ada}
+team["lead"].age`,
+			expected: []string{`User {name: "Ada", age: 36}`, "Ada", `[41, "Bob"]`, "true", "false", "36"},
+		},
+		{
+			name:     "Accessing a missing field",
+			input:    "type P = {x: int}\nlet p = P {x: 1}\np.y",
+			expected: []string{""},
+			err:      "P has no field y",
+		},
+		{
+			name: "Sum types",
+			input: `type Shape = Circle(int) | Rect(int, int) | Empty
+let area = fn(s) => match s {
+  Circle(r) => 3 * r * r,
+  Rect(w, h) => w * h,
+  Empty => 0,
+}
+let shapes = [Circle(2), Rect(3, 4), Empty]
+shapes
+let areas = [area(shapes[0]), area(shapes[1]), area(shapes[2])]
+areas
+let square = fn(n) => Rect(n, n)
+square(5)
+let make = Circle
+make(1) == Circle(1)
+Circle(1) == Circle(2)
+type Option = Some(Shape) | None
+match Some(Rect(2, 0)) {
+  Some(Rect(w, 0)) => "flat ${w}",
+  Some(s) => "shape ${s}",
+  None => "nothing",
+}`,
+			expected: []string{
+				"[Circle(2), Rect(3, 4), Empty]",
+				"[12, 12, 0]",
+				"Rect(5, 5)",
+				"true",
+				"false",
+				"flat 2",
+			},
+		},
+		{
+			name:     "Constructor with the wrong number of arguments",
+			input:    "type T = Pair(int, int)\nPair(1)",
+			expected: []string{""},
+			err:      "Pair expects 2 arguments, got 1",
+		},
+		{
+			name: "Tuples and destructuring",
+			input: `let divmod = fn(a, b) => (a / b, a % b)
+let (q, r) = divmod(7, 2)
+q * 10 + r
+divmod(9, 4)
+let xs = [10, 20, 30]
+let [first, second, ..rest] = xs
+first + second
+rest
+let sum3 = fn(p) => {
+  let (a, (b, c)) = p
+  a + b + c
+}
+sum3((1, (2, 3)))
+var (x, y) = (1, 2)
+x = x + 10
+let same = (x, y) == (11, 2)
+same
+match (1, "a") { (0, s) => s, (n, s) => "${n}${s}" }
+let later = fn(n) => {
+  let (u, v) = (n, n * 2)
+  fn() => u + v
+}
+later(5)()`,
+			expected: []string{"31", "(2, 1)", "30", "[30]", "6", "true", "1a", "15"},
+		},
+		{
+			name:     "Destructuring a list of the wrong length",
+			input:    "let [a, b] = [1, 2, 3]",
+			expected: []string{""},
+			err:      "let pattern does not match value: [1, 2, 3]",
+		},
+		{
+			name: "Unary minus",
+			input: `let x = 7
+let a = [-5, -x, - -3, -(2 + 3)]
+a
+let b = -2.5 * 2.0
+b
+let xs = [4]
+let c = [2 - -3, -xs[0] + 1]
+c
+let sign = fn(n) => match n { -1 => "minus one", 0 => "zero", _ => "other" }
+let signs = [sign(-1), sign(0), sign(-2)]
+signs`,
+			expected: []string{"[-5, -7, 3, -5]", "-5.0", "[5, -3]", `["minus one", "zero", "other"]`},
+		},
+		{
+			name: "Minus at the start of a line",
+			input: `10 / 4
+-7 % 3
+let x = 5
+-x
+let d = 9 -
+  2
+d
+let s = "a"
+  + "b"
+s`,
+			expected: []string{"2", "-1", "-5", "7", "ab"},
+		},
+		{
+			name: "Negating a string",
+			input: `let s = "a"
+print(-s)`,
+			expected: []string{""},
+			err:      "invalid operand for -: string",
+		},
+		{
+			name: "Named functions",
+			input: `fact(5)
+fn fact(n: int): int => if n < 2 then 1 else n * fact(n - 1)
+fn isEven(n: int): bool => if n == 0 then true else isOdd(n - 1)
+fn isOdd(n: int): bool => if n == 0 then false else isEven(n - 1)
+let parities = [isEven(10), isOdd(7), isEven(3)]
+parities
+fn fib(n) => if n < 2 then n else fib(n - 1) + fib(n - 2)
+fib(15)
+let twice = fn(f) => fn(x) => f(f(x))
+twice(fact)(3)`,
+			expected: []string{"120", "[true, true, false]", "610", "720"},
+		},
+		{
+			name: "Default, named and variadic parameters",
+			input: `fn count(start: int, stop: int, step: int = 1): int => (stop - start) / step
+let counts = [count(0, 10), count(0, 10, 2), count(0, 10, step: 5), count(stop: 4, start: 0)]
+counts
+let greet = fn(name: string, greeting: string = "Hello, " + name) => greeting
+greet("Ann")
+greet(greeting: "Hi", name: "Bo")
+fn sum(...xs: [int]): int => {
+  var total = 0
+  for x in xs { total = total + x }
+  total
+}
+let sums = [sum(), sum(1, 2, 3)]
+sums
+fn tag(label: string, ...items: [int]) => (label, items)
+tag("a", 1, 2)`,
+			expected: []string{"[10, 5, 2, 4]", "Hello, Ann", "Hi", "[0, 6]", `("a", [1, 2])`},
+		},
+		{
+			name: "Missing argument",
+			input: `let f = fn(x, y = 1) => x + y
+f(y: 2)`,
+			expected: []string{""},
+			err:      "missing argument for parameter x",
+		},
+		{
+			name: "Pipe operator",
+			input: `let double = fn(x: int) => x * 2
+let add = fn(a: int, b: int) => a + b
+5 |> double
+5 |> add(3) |> double
+fn count(start: int, stop: int, step: int = 1): int => (stop - start) / step
+0 |> count(10, step: 2)
+let fs = [double]
+1 + 2 |> fs[0]
+3 |> (fn(x) => x - 1)`,
+			expected: []string{"10", "16", "5", "6", "2"},
+		},
+		{
+			name: "Try and catch",
+			input: `let d = {"a": 1}
+let v = try { d["b"] } catch e { 0 }
+v
+try { d["b"] } catch e { e.message }
+let xs = [1, 2]
+try { xs[5] } catch e { e }
+let safeDiv = fn(a: int, b: int) => try { a / b } catch e { -1 }
+safeDiv(6, 0)
+fn check(n: int): int => if n < 0 then throw("negative: ${n}") else n
+try { check(-3) } catch e { e.message }
+let r = try { try { throw(error("inner")) } catch e { throw("outer after " + e.message) } } catch e { e.message }
+r
+var count = 0
+for i in 0..5 {
+  try { if i == 3 then break else throw("skip") } catch e { count = count + 1 }
+}
+count
+let f = try {
+  let k = 10
+  let g = fn() => k
+  throw("boom")
+  g
+} catch e { fn() => 0 }
+f()`,
+			expected: []string{"0", `key not found: "b"`, `error("list index 5 out of range for length 2")`, "-1", "negative: -3", "outer after inner", "3", "0"},
+		},
+		{
+			name: "Uncaught throw",
+			input: `let d = {"a": 1}
+try { d["b"] } catch e { throw("lookup failed: " + e.message) }`,
+			expected: []string{""},
+			err:      `lookup failed: key not found: "b"`,
+		},
+		{
+			name: "Collection builtins",
+			input: `let xs = [3, 1, 2]
+let d = {"b": 2, "a": 1}
+let sizes = [len(xs), len(d), len("héllo")]
+sizes
+let ys = push(xs, 4)
+xs
+ys
+slice(ys, 1, 3)
+slice("flux-lang", 5)
+keys(d)
+values(d)
+entries(d)
+let found = [contains(xs, 2), contains(d, "c"), contains("flux", "lu")]
+found
+range(3)
+range(10, 0, -3)
+for i in range(len(xs)) { print(xs[i]) }
+println()
+let values = "shadowed"
+values`,
+			expected: []string{"[3, 2, 5]", "[3, 1, 2]", "[3, 1, 2, 4]", "[1, 2]", "lang", `["a", "b"]`, "[1, 2]", `[("a", 1), ("b", 2)]`, "[true, false, true]", "[0, 1, 2]", "[10, 7, 4, 1]", "312", "shadowed"},
+		},
+		{
+			name: "Slice out of range",
+			input: `let xs = [1, 2]
+slice(xs, 1, 3)`,
+			expected: []string{""},
+			err:      "slice bounds 1..3 out of range for length 2",
+		},
+		{
+			name: "Higher-order builtins",
+			input: `let xs = [3, 1, 2]
+map(xs, fn(x) => x * 10)
+filter(xs, fn(x) => x > 1)
+reduce(xs, 0, fn(acc, x) => acc + x)
+let checks = [any(xs, fn(x) => x == 2), all(xs, fn(x) => x > 1)]
+checks
+find(xs, fn(x) => x < 3)
+sort(xs)
+sort(["b", "c", "a"], fn(a, b) => if a < b then 1 else if a > b then -1 else 0)
+zip(xs, ["a", "b"])
+enumerate(["a", "b"])
+let offset = 100
+xs |> map(fn(x) => x + offset) |> filter(fn(x) => x % 2 == 1)
+map([[1, 2], [3]], fn(ys) => map(ys, fn(y) => y * 2))
+map(["a", "bc"], len)`,
+			expected: []string{"[30, 10, 20]", "[3, 2]", "6", "[true, false]", "1", "[1, 2, 3]", `["c", "b", "a"]`, `[(3, "a"), (1, "b")]`, `[(0, "a"), (1, "b")]`, "[103, 101]", "[[2, 4], [6]]", "[1, 2]"},
+		},
+		{
+			name: "Errors in callbacks",
+			input: `let xs = [3, 1, 2]
+map(xs, fn(x) => try { 6 / (x - 1) } catch e { -1 })
+try { map(xs, fn(x) => if x == 1 then throw("one") else x) } catch e { [e.message] }
+find(xs, fn(x) => x > 5)`,
+			expected: []string{"[3, -1, 6]", `["one"]`},
+			err:      "find: no element matches",
+		},
+		{
+			name: "String builtins",
+			input: `let line = "  2024-01-05 ERROR disk full  "
+let parts = split(trim(line), " ")
+parts
+join(parts, "|")
+let cases = [upper("flux"), lower("ÀB"), replace("a-b-c", "-", "+")]
+cases
+let checks = [startsWith("flux", "fl"), endsWith("flux", "fl")]
+checks
+let positions = [indexOf("héllo", "l"), indexOf("abc", "z")]
+positions
+substring("héllo", 1, 3)
+substring("héllo", 2)
+repeat("ab", 3)
+padLeft("7", 3, "0")
+padRight("ab", 4) + "|"
+chars("hé")
+format("{} has {} items: {} {{ok}}", "cart", 3, [1, 2])
+sprintf("%05.2f|%-4d|%s|%x|%q|100%%", 3.14159, 42, "s", 255, "q")`,
+			expected: []string{`["2024-01-05", "ERROR", "disk", "full"]`, "2024-01-05|ERROR|disk|full", `["FLUX", "àb", "a+b+c"]`, "[true, false]", "[2, -1]", "él", "llo", "ababab", "007", "ab  |", `["h", "é"]`, "cart has 3 items: [1, 2] {ok}", `03.14|42  |s|ff|"q"|100%`},
+		},
+		{
+			name: "String builtin errors",
+			input: `let e1 = try { sprintf("%d", "x") } catch e { e.message }
+e1
+let e2 = try { format("{} {}", 1) } catch e { e.message }
+e2
+let e3 = try { padLeft("a", 3, "ab") } catch e { e.message }
+e3
+join([1, 2], ",")`,
+			expected: []string{"sprintf verb %d cannot format string", "format template needs 2 arguments, got 1", `padLeft expects a single character to pad with, got "ab"`},
+			err:      "join expects a list of strings, got an element of type int",
+		},
+		{
+			name: "Conversion builtins",
+			input: `str(42) + "!"
+let ints = [int("12") + 1, int(3.9), int(-3.9), int(true)]
+ints
+let bools = [bool("false"), bool(0), bool(2.5)]
+bools
+let floats = [float(2), float("1.5"), float(false), float(2.5)]
+floats
+let bad = parseInt("x1")
+bad
+typeof(bad)
+parseInt("7") + 1
+let names = [typeof(1), typeof(1.5), typeof("s"), typeof(true), typeof(println())]
+names
+let shapes = [typeof([1, 2]), typeof([]), typeof({"a": [1]}), typeof((1, "x"))]
+shapes
+typeof(fn(a, b) => a)
+type Point = { x: int, y: int }
+typeof(Point { x: 1, y: 2 })
+map(["1", "2"], int)
+int("abc")`,
+			expected: []string{"42!", "[13, 3, -3, 1]", "[false, false, true]", "[2.0, 1.5, 0.0, 2.5]", `error("cannot parse \"x1\" as int")`, "error", "8", "", `["int", "float", "string", "bool", "void"]`, `["[int]", "[unknown]", "{string: [int]}", "(int, string)"]`, "fn(unknown, unknown) -> unknown", "Point", "[1, 2]"},
+			err:      `cannot parse "abc" as int`,
+		},
+		{
+			name: "Empty loop bodies",
+			input: `var flag = false
+while flag { }
+let xs = [1, 2]
+for x in xs { }
+for i in 0..len(xs) {}
+type Empty = {}
+type Point = { x: int }
+let p = Point { x: 1 }
+while p == (Point { x: 2 }) { }
+Empty {}`,
+			expected: []string{"Empty {}"},
+		},
+		{
+			name: "Block body ending in a tuple",
+			input: `let divmod = fn(a, b) => {
+  let q = a / b
+  let r = a % b
+  (q, r)
+}
+let (q, r) = divmod(17, 5)
+[q, r]
+let id = fn(x) => x
+id
+(1, 2)`,
+			expected: []string{"[3, 2]", "<fn>", "(1, 2)"},
+		},
+		{
+			name: "Break inside a closure inside a loop",
+			input: `for x in [1, 2, 3] {
+  let stop = fn() => break
+  stop()
+}`,
+			err: "break or continue outside of a loop",
+		},
+		{
+			name: "Assigning to a call",
+			input: `var n = 1
+let f = fn() => n
+f() = 2`,
+			err: "invalid assignment target",
+		},
+		{
+			name: "Unhashable dict keys",
+			input: `let d = {1: "a"}
+try { d[[1]] } catch e { e.message }
+try { {(1, 2): "a"} } catch e { e.message }
+try { contains(d, {}) } catch e { e.message }
+var m = {}
+try { m[(1, 2)] = 1 } catch e { e.message }`,
+			expected: []string{"list cannot be used as a dict key", "tuple cannot be used as a dict key", "dict cannot be used as a dict key", "tuple cannot be used as a dict key"},
+		},
+		{
+			name:     "More than 256 constants",
+			input:    "var total = 0\nfor i in 0..2 {\n" + strings.Repeat("  total = total + 1\n", 90) + "}\ntotal",
+			expected: []string{"180"},
+		},
+		{
+			name:  "Record of an undeclared type",
+			input: "let p = Point { x: 1, y: 2 }\np.x",
+			err:   "unknown type: Point",
+		},
+		{
+			name: "Pattern with an undeclared constructor",
+			input: `match 1 {
+  Box(x) => x,
+  _ => 0,
+}`,
+			err: "unknown constructor: Box",
+		},
+		{
+			name: "Division by zero",
+			input: `let div = fn(a, b) => a / b
+println("before")
+div(1, 0)
+println("after")`,
+			expected: []string{"before"},
+			err:      "division by zero",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prog, err := parser.Parse(tt.input)
+			if err != nil {
+				t.Fatalf("Parse error: %v", err)
+			}
+			var out bytes.Buffer
+			runErr := runtime.RunWithConfig(prog, runtime.Config{Out: &out, Echo: true})
+			output := out.String()
+			if tt.err == "" && runErr != nil {
+				t.Fatalf("Runtime error: %v", runErr)
+			}
+			if tt.err != "" && (runErr == nil || runErr.Error() != tt.err) {
+				t.Errorf("Expected runtime error %q, got %v", tt.err, runErr)
+			}
+			lines := strings.Split(strings.TrimRight(output, "\n"), "\n")
+			if strings.Join(lines, "\n") != strings.Join(tt.expected, "\n") {
+				t.Errorf("Expected output %q, got %q", tt.expected, lines)
+			}
+		})
+	}
+}
+
+// TestPrint runs programs without echoing, so only print and println write
+// output.
+func TestPrint(t *testing.T) {
+	input := `let greet = fn(name) => println("Hello,", name)
+greet("Ada")
+let _ = print(1, 2.5, [3], "x")
+println()
+let total = {
+  print("sum: ")
+  1 + 2
+}
+println(total)
+total * 2
+let xs = [1, 2, 3]
+for x in xs { print(x) }
+println()`
+	prog, err := parser.Parse(input)
+	if err != nil {
+		t.Fatalf("Parse error: %v", err)
+	}
+	var out bytes.Buffer
+	if err := runtime.RunWithConfig(prog, runtime.Config{Out: &out}); err != nil {
+		t.Fatalf("Runtime error: %v", err)
+	}
+	expected := "Hello, Ada\n1 2.5 [3] x\nsum: 3\n123\n"
+	if out.String() != expected {
+		t.Errorf("Expected output %q, got %q", expected, out.String())
+	}
+}
@@ -8,6 +8,12 @@ import (
 
 // Convert AST type annotations to internal FluxType
 func ConvertASTType(astType *ast.Type) (FluxType, error) {
+	return convertASTType(astType, nil)
+}
+
+// convertASTType converts a type annotation, looking up named types in
+// typeDefs.
+func convertASTType(astType *ast.Type, typeDefs map[string]FluxType) (FluxType, error) {
 	if astType == nil {
 		return nil, fmt.Errorf("nil AST type")
 	}
@@ -17,6 +23,8 @@ func ConvertASTType(astType *ast.Type) (FluxType, error) {
 		switch *astType.Basic {
 		case "int":
 			return IntType{}, nil
+		case "float":
+			return FloatType{}, nil
 		case "string":
 			return StringType{}, nil
 		case "bool":
@@ -28,18 +36,18 @@ func ConvertASTType(astType *ast.Type) (FluxType, error) {
 		}
 
 	case astType.List != nil:
-		elemType, err := ConvertASTType(astType.List.ElemType)
+		elemType, err := convertASTType(astType.List.ElemType, typeDefs)
 		if err != nil {
 			return nil, fmt.Errorf("error converting list element type: %w", err)
 		}
 		return ListType{ElementType: elemType}, nil
 
 	case astType.Dict != nil:
-		keyType, err := ConvertASTType(astType.Dict.KeyType)
+		keyType, err := convertASTType(astType.Dict.KeyType, typeDefs)
 		if err != nil {
 			return nil, fmt.Errorf("error converting dict key type: %w", err)
 		}
-		valueType, err := ConvertASTType(astType.Dict.ValueType)
+		valueType, err := convertASTType(astType.Dict.ValueType, typeDefs)
 		if err != nil {
 			return nil, fmt.Errorf("error converting dict value type: %w", err)
 		}
@@ -48,20 +56,40 @@ func ConvertASTType(astType *ast.Type) (FluxType, error) {
 	case astType.Function != nil:
 		paramTypes := make([]FluxType, len(astType.Function.ParamTypes))
 		for i, paramType := range astType.Function.ParamTypes {
-			pt, err := ConvertASTType(paramType)
+			pt, err := convertASTType(paramType, typeDefs)
 			if err != nil {
 				return nil, fmt.Errorf("error converting function parameter %d type: %w", i, err)
 			}
 			paramTypes[i] = pt
 		}
 
-		returnType, err := ConvertASTType(astType.Function.ReturnType)
+		returnType, err := convertASTType(astType.Function.ReturnType, typeDefs)
 		if err != nil {
 			return nil, fmt.Errorf("error converting function return type: %w", err)
 		}
 
 		return FunctionType{ParamTypes: paramTypes, ReturnType: returnType}, nil
 
+	case astType.Tuple != nil:
+		elemTypes := make([]FluxType, len(astType.Tuple.ElemTypes))
+		for i, elemType := range astType.Tuple.ElemTypes {
+			et, err := convertASTType(elemType, typeDefs)
+			if err != nil {
+				return nil, fmt.Errorf("error converting tuple element %d type: %w", i, err)
+			}
+			elemTypes[i] = et
+		}
+		return TupleType{ElemTypes: elemTypes}, nil
+
+	case astType.Named != nil:
+		if t, ok := typeDefs[*astType.Named]; ok {
+			return t, nil
+		}
+		if *astType.Named == "error" {
+			return ErrorType{}, nil
+		}
+		return nil, fmt.Errorf("unknown type: %s", *astType.Named)
+
 	default:
 		return nil, fmt.Errorf("unknown AST type")
 	}
@@ -73,6 +101,9 @@ func ConvertFluxTypeToAST(fluxType FluxType) (*ast.Type, error) {
 	case IntType:
 		basic := "int"
 		return &ast.Type{Basic: &basic}, nil
+	case FloatType:
+		basic := "float"
+		return &ast.Type{Basic: &basic}, nil
 	case StringType:
 		basic := "string"
 		return &ast.Type{Basic: &basic}, nil
@@ -126,6 +157,25 @@ func ConvertFluxTypeToAST(fluxType FluxType) (*ast.Type, error) {
 				ReturnType: returnType,
 			},
 		}, nil
+	case TupleType:
+		elemTypes := make([]*ast.Type, len(t.ElemTypes))
+		for i, et := range t.ElemTypes {
+			elemType, err := ConvertFluxTypeToAST(et)
+			if err != nil {
+				return nil, fmt.Errorf("error converting tuple element %d type: %w", i, err)
+			}
+			elemTypes[i] = elemType
+		}
+		return &ast.Type{Tuple: &ast.TupleType{ElemTypes: elemTypes}}, nil
+	case ErrorType:
+		name := "error"
+		return &ast.Type{Named: &name}, nil
+	case RecordType:
+		name := t.Name
+		return &ast.Type{Named: &name}, nil
+	case VariantType:
+		name := t.Name
+		return &ast.Type{Named: &name}, nil
 	default:
 		return nil, fmt.Errorf("unknown or unsupported FluxType: %T", fluxType)
 	}
@@ -0,0 +1,212 @@
+package types
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pranavms13/flux-lang/ast"
+)
+
+// TypeVar stands for any type in the signature of a builtin, such as a in
+// fn([a], a) -> [a]. Each call binds it to the type of its arguments.
+type TypeVar struct {
+	Name string
+}
+
+func (t TypeVar) String() string { return t.Name }
+
+// Equals accepts any type, like UnknownType; type variables are replaced
+// before the types of a call are compared.
+func (t TypeVar) Equals(other FluxType) bool { return true }
+
+// BuiltinType is the type of a builtin function with one or more generic
+// signatures, such as len, which takes a list, a dict or a string. A call
+// uses the first signature its arguments match.
+type BuiltinType struct {
+	Name       string
+	Signatures []FunctionType
+}
+
+func (t BuiltinType) String() string {
+	sigs := make([]string, len(t.Signatures))
+	for i, sig := range t.Signatures {
+		sigs[i] = sig.String()
+	}
+	return strings.Join(sigs, " | ")
+}
+
+func (t BuiltinType) Equals(other FluxType) bool {
+	for _, sig := range t.Signatures {
+		if substitute(sig, nil).Equals(other) {
+			return true
+		}
+	}
+	return false
+}
+
+// fnType builds the signature of a builtin.
+func fnType(ret FluxType, params ...FluxType) FunctionType {
+	return FunctionType{ParamTypes: params, ReturnType: ret}
+}
+
+// checkBuiltinCall checks a call to a builtin against each of its
+// signatures and returns the result type of the first one that matches.
+func (tc *TypeChecker) checkBuiltinCall(builtin BuiltinType, call *ast.CallExpr) FluxType {
+	// When only one signature takes this many arguments, the arguments
+	// before a function literal tell the types of its unannotated
+	// parameters, as in map(xs, fn(x) => x + 1).
+	var hint *FunctionType
+	for i, sig := range builtin.Signatures {
+		if len(sig.ParamTypes) == len(call.Args) {
+			if hint != nil {
+				hint = nil
+				break
+			}
+			hint = &builtin.Signatures[i]
+		}
+	}
+	hints := map[string]FluxType{}
+
+	argTypes := make([]FluxType, len(call.Args))
+	for i, arg := range call.Args {
+		if arg.Name != nil {
+			tc.Error(fmt.Sprintf("no parameter named %s", *arg.Name))
+		}
+		if hint == nil {
+			argTypes[i] = tc.CheckExpr(arg.Value)
+			continue
+		}
+		if fn, ok := hint.ParamTypes[i].(FunctionType); ok && arg.Value.Func != nil {
+			expected := make([]FluxType, len(fn.ParamTypes))
+			for j, param := range fn.ParamTypes {
+				expected[j] = substitute(param, hints)
+			}
+			argTypes[i] = tc.checkFuncExpr(arg.Value.Func, expected)
+		} else {
+			argTypes[i] = tc.CheckExpr(arg.Value)
+		}
+		unify(hint.ParamTypes[i], argTypes[i], hints)
+	}
+
+	for _, sig := range builtin.Signatures {
+		if len(sig.ParamTypes) != len(argTypes) {
+			continue
+		}
+		bindings := map[string]FluxType{}
+		matched := true
+		for i, param := range sig.ParamTypes {
+			if !unify(param, argTypes[i], bindings) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return substitute(sig.ReturnType, bindings)
+		}
+	}
+
+	args := make([]string, len(argTypes))
+	for i, t := range argTypes {
+		args[i] = t.String()
+	}
+	tc.Error(fmt.Sprintf("cannot call %s with (%s), expected %s",
+		builtin.Name, strings.Join(args, ", "), builtin.String()))
+	return UnknownType{}
+}
+
+// unify reports whether a value of type arg can be passed for a parameter
+// of type param, binding the type variables in param as it goes. Unknown
+// types match anything without binding a variable.
+func unify(param, arg FluxType, bindings map[string]FluxType) bool {
+	if isUnknown(arg) {
+		return true
+	}
+	switch p := param.(type) {
+	case TypeVar:
+		bound, ok := bindings[p.Name]
+		if !ok || isUnknown(bound) {
+			bindings[p.Name] = arg
+			return true
+		}
+		return TypesEqual(bound, arg)
+	case ListType:
+		a, ok := arg.(ListType)
+		return ok && unify(p.ElementType, a.ElementType, bindings)
+	case DictType:
+		a, ok := arg.(DictType)
+		return ok && unify(p.KeyType, a.KeyType, bindings) && unify(p.ValueType, a.ValueType, bindings)
+	case TupleType:
+		a, ok := arg.(TupleType)
+		if !ok || len(a.ElemTypes) != len(p.ElemTypes) {
+			return false
+		}
+		for i, elem := range p.ElemTypes {
+			if !unify(elem, a.ElemTypes[i], bindings) {
+				return false
+			}
+		}
+		return true
+	case FunctionType:
+		if b, ok := arg.(BuiltinType); ok {
+			// A builtin passed as a function must have a matching signature;
+			// its own type variables are left unknown
+			for _, sig := range b.Signatures {
+				tried := map[string]FluxType{}
+				for name, t := range bindings {
+					tried[name] = t
+				}
+				if unify(p, substitute(sig, nil), tried) {
+					for name, t := range tried {
+						bindings[name] = t
+					}
+					return true
+				}
+			}
+			return false
+		}
+		a, ok := arg.(FunctionType)
+		if !ok || len(a.ParamTypes) != len(p.ParamTypes) {
+			return false
+		}
+		for i, paramType := range p.ParamTypes {
+			if !unify(paramType, a.ParamTypes[i], bindings) {
+				return false
+			}
+		}
+		return unify(p.ReturnType, a.ReturnType, bindings)
+	default:
+		return TypesEqual(param, arg)
+	}
+}
+
+// substitute replaces the type variables in t with their bindings. Unbound
+// variables become unknown.
+func substitute(t FluxType, bindings map[string]FluxType) FluxType {
+	switch t := t.(type) {
+	case TypeVar:
+		if bound, ok := bindings[t.Name]; ok {
+			return bound
+		}
+		return UnknownType{}
+	case ListType:
+		return ListType{ElementType: substitute(t.ElementType, bindings)}
+	case DictType:
+		return DictType{KeyType: substitute(t.KeyType, bindings), ValueType: substitute(t.ValueType, bindings)}
+	case TupleType:
+		elems := make([]FluxType, len(t.ElemTypes))
+		for i, elem := range t.ElemTypes {
+			elems[i] = substitute(elem, bindings)
+		}
+		return TupleType{ElemTypes: elems}
+	case FunctionType:
+		params := make([]FluxType, len(t.ParamTypes))
+		for i, param := range t.ParamTypes {
+			params[i] = substitute(param, bindings)
+		}
+		t.ParamTypes = params
+		t.ReturnType = substitute(t.ReturnType, bindings)
+		return t
+	default:
+		return t
+	}
+}
@@ -0,0 +1,344 @@
+package types_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pranavms13/flux-lang/parser"
+	"github.com/pranavms13/flux-lang/types"
+)
+
+func TestTypeChecker(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		strict   bool
+		errors   []string
+		warnings []string
+	}{
+		{
+			name:  "Logical operators on bools",
+			input: `let ok: bool = !(1 > 2) && (true || false)`,
+		},
+		{
+			name:   "Strict logical operators require bools",
+			input:  `let a = 1 && true` + "\n" + `let b = !"yes"`,
+			strict: true,
+			errors: []string{
+				"invalid operands for &&: int and bool",
+				"invalid operand for !: string",
+			},
+		},
+		{
+			name:     "Lenient logical operators treat values as truthy",
+			input:    `let a = 1 || 2`,
+			warnings: []string{"invalid operands for ||: int and int (treating as truthy)"},
+		},
+		{
+			name:  "Ordering ints and strings",
+			input: `let a: bool = 1 <= 2` + "\n" + `let b: bool = "a" >= "b"` + "\n" + `let c: bool = 1 != 2`,
+		},
+		{
+			name:   "Strict ordering of mixed types",
+			input:  `let a = 1 < "b"`,
+			strict: true,
+			errors: []string{"invalid operands for <: int and string"},
+		},
+		{
+			name:  "Float arithmetic",
+			input: `let avg: float = (90.0 + 75.5) / 2.0` + "\n" + `let ratio: float = 1e-3 * avg`,
+		},
+		{
+			name:     "Lenient int and float mixing widens",
+			input:    `let x: float = 1 + 0.5`,
+			warnings: []string{"mixed int and float operands for +: int and float (widening int to float)"},
+		},
+		{
+			name:   "Strict int and float mixing is an error",
+			input:  `let x = 2.0 * 3`,
+			strict: true,
+			errors: []string{"mixed int and float operands for *: float and int (convert explicitly)"},
+		},
+		{
+			name:  "Negation keeps the numeric type",
+			input: "let a: int = -5\nlet b: float = -2.5\nlet c: int = -a + 1",
+		},
+		{
+			name:   "Negating a non-number",
+			input:  "let s = -\"a\"",
+			errors: []string{"invalid operand for -: string"},
+		},
+		{
+			name:  "Interpolation is a string",
+			input: `let n = 3` + "\n" + `let s: string = "n = ${n * 2}"`,
+		},
+		{
+			name:   "Interpolated expressions are checked",
+			input:  `let s = "hi ${missing}"`,
+			errors: []string{"undefined variable: missing"},
+		},
+		{
+			name:  "Assignment to var",
+			input: "var n: int = 0\nn = n + 1\nvar xs: [int] = []\nxs[0] = n\nvar d = {\"a\": 1}\nd[\"b\"] = 2",
+		},
+		{
+			name:   "Assignment to let is an error",
+			input:  "let n = 0\nn = 1\nlet xs = [1]\nxs[0] = 2",
+			errors: []string{"cannot assign to immutable variable n (declare it with var)", "cannot assign to an element of immutable variable xs (declare it with var)"},
+		},
+		{
+			name:   "Assignment cannot change a variable's type",
+			input:  "var n = 0\nn = \"one\"\nvar xs = [1]\nxs[0] = true",
+			strict: true,
+			errors: []string{"type mismatch: cannot assign string to variable n of type int", "type mismatch: cannot assign bool to element of [int] of type int"},
+		},
+		{
+			name:   "Assignment to undefined variable",
+			input:  "total = 1",
+			errors: []string{"undefined variable: total"},
+		},
+		{
+			name:   "Indexing an unannotated parameter",
+			input:  "let first = fn(xs) => xs[0]\nlet n = first([1, 2])\nlet get = fn(d, k) => d[k][0]",
+			strict: true,
+		},
+		{
+			name:   "Dict keys must be hashable",
+			input:  "let d = {(1, 2): \"a\"}\nlet e = {}\nlet x = e[[1]]",
+			errors: []string{"dictionary key cannot be of type (int, int)", "dictionary key cannot be of type [int]"},
+		},
+		{
+			name:  "Loop variables are typed",
+			input: "var total = 0\nfor x in [1, 2] { total = total + x }\nfor k in {\"a\": 1} { let s: string = k }\nfor i in 0..3 { let n: int = i }\nwhile total < 10 { total = total * 2 }",
+		},
+		{
+			name:   "Loop errors",
+			input:  "break\nwhile true { let f = fn() => continue }\nfor c in 5 { c }\nfor i in 0..\"a\" { i }",
+			errors: []string{"break outside of a loop", "continue outside of a loop", "cannot iterate over int", "range bounds must be int, got int and string"},
+		},
+		{
+			name:   "Strict while condition must be bool",
+			input:  "while 1 { 0 }",
+			strict: true,
+			errors: []string{"while condition must be bool, got int"},
+		},
+		{
+			name:  "Match bindings are typed",
+			input: "let xs: [int] = [1, 2]\nlet n: int = match xs { [a, ..] if a > 0 => a, _ => 0 }\nlet r: [int] = match xs { [_, ..rest] => rest, _ => xs }\nlet d = {\"k\": \"v\"}\nlet s: string = match d { {\"k\": v} => v, _ => \"\" }",
+		},
+		{
+			name:   "Match pattern and arm errors",
+			input:  "let xs: [int] = [1]\nmatch xs { [\"a\"] => 1, {\"k\": v} => 2, _ => \"three\" }\nmatch 1 { x if x => 1 }",
+			strict: true,
+			errors: []string{
+				"pattern type mismatch: string pattern cannot match int",
+				"pattern type mismatch: dict pattern cannot match [int]",
+				"match arms must have same type: arm 1 is int, arm 3 is string",
+				"match guard must be bool, got int",
+			},
+		},
+		{
+			name:  "Record fields are typed",
+			input: "let u = User {name: \"Ada\", age: 36}\nlet n: string = u.name\ntype User = {name: string, age: int}\ntype Team = {lead: User, members: [User]}\nvar t = Team {lead: u, members: [u]}\nt.lead.age = t.members[0].age + 1\nlet greet = fn(x: User): string => x.name",
+		},
+		{
+			name:   "Record errors",
+			input:  "type User = {name: string, age: int}\nlet u = User {name: 1, nick: \"a\"}\nu.age = 2\nu.email\nlet p = Point {x: 1}\n3.size",
+			strict: true,
+			errors: []string{
+				"type mismatch: cannot assign int to User.name of type string",
+				"User has no field nick",
+				"missing field age in User literal",
+				"cannot assign to a field of immutable variable u (declare it with var)",
+				"User has no field email",
+				"unknown type: Point",
+				"cannot access field size of int",
+			},
+		},
+		{
+			name:  "Sum type constructors and patterns are typed",
+			input: "type Result = Ok(int) | Err(string)\nlet parse = fn(s: string): Result => if s == \"\" then Err(\"empty\") else Ok(1)\nlet n: int = match parse(\"1\") { Ok(v) => v, Err(_) => 0 }\nlet wrap: fn(int) -> Result = Ok\ntype Light = Red | Green\nlet l: Light = Red\nlet go: bool = match l { Red => false, Green => true }",
+		},
+		{
+			name:   "Sum type errors",
+			input:  "type Shape = Circle(int) | Rect(int, int)\ntype Light = Red | Green\nlet c = Circle(\"x\")\nmatch Rect(1, 2) { Circle(r) => r, Rect(w) => w, Red => 0, Box(b) => b }\nmatch Circle(1) { Circle(0) => 0, Rect(w, h) if w > h => w }",
+			strict: true,
+			errors: []string{
+				"argument 0 has type string, expected int",
+				"Rect pattern expects 2 arguments, got 1",
+				"pattern type mismatch: Red pattern cannot match Shape",
+				"unknown constructor: Box",
+				"match on Shape is not exhaustive: missing Circle, Rect",
+			},
+		},
+		{
+			name:  "Tuples and destructured bindings are typed",
+			input: "let divmod = fn(a: int, b: int): (int, int) => (a / b, a % b)\nlet (q, r) = divmod(7, 2)\nlet n: int = q + r\nlet pair: (int, string) = (1, \"a\")\nvar (k, s) = pair\ns = \"b\"\nlet [x, ..xs] = [1, 2]\nlet ys: [int] = xs",
+		},
+		{
+			name:   "Tuple arity and destructuring errors",
+			input:  "let (a, b) = (1, 2, 3)\nlet (c, d): (int, string) = (1, 2)\nlet (e, f) = 5\nlet (g, h) = (1, \"x\")\ng = 2",
+			strict: true,
+			errors: []string{
+				"pattern type mismatch: tuple pattern of 2 elements cannot match (int, int, int)",
+				"type mismatch: let pattern declared as (int, string) but assigned (int, int)",
+				"pattern type mismatch: tuple pattern cannot match int",
+				"cannot assign to immutable variable g (declare it with var)",
+			},
+		},
+		{
+			name:   "Named functions are visible before their declaration",
+			input:  "let n: int = fact(5)\nfn fact(n: int): int => if n < 2 then 1 else n * fact(n - 1)\nfn isEven(n: int): bool => if n == 0 then true else isOdd(n - 1)\nfn isOdd(n: int): bool => if n == 0 then false else isEven(n - 1)",
+			strict: true,
+		},
+		{
+			name:   "Named function errors",
+			input:  "let s: string = twice(1)\nfn twice(n: int): int => n * 2\nfn twice(n: int): int => n + n\nlet f = fn(x: int) => {\n fn inner() => x\n x\n}",
+			strict: true,
+			errors: []string{
+				"function twice is already declared",
+				"type mismatch: variable s declared as string but assigned int",
+				"function declarations must be at the top level",
+			},
+		},
+		{
+			name:   "Default, named and variadic parameters",
+			input:  "fn count(start: int, stop: int, step: int = 1): int => (stop - start) / step\nlet a: int = count(0, 10)\nlet b: int = count(stop: 4, start: 0, step: 2)\nfn sum(...xs: [int]): int => 0\nlet c: int = sum()\nlet d: int = sum(1, 2, 3)\nlet greet = fn(name: string, greeting = \"Hi\") => greeting + name\nlet e: string = greet(\"Ann\")",
+			strict: true,
+		},
+		{
+			name:   "Default, named and variadic parameter errors",
+			input:  "fn f(x: int, y: int = \"a\") => x\nfn g(...xs: int) => 1\nfn h(...xs, y) => 1\nf(1, 2, 3)\nf(1, z: 2)\nf(x: 1, 2)\nf(y: 2)\nf(1, x: 2)\nfn sum(...xs: [int]) => 0\nsum(1, \"b\")",
+			strict: true,
+			errors: []string{
+				"default value for parameter y has type string, expected int",
+				"variadic parameter xs must have a list type, got int",
+				"variadic parameter xs must be last",
+				"function expects at most 2 arguments, got 3",
+				"no parameter named z",
+				"positional argument after named argument",
+				"missing argument for parameter x",
+				"parameter x given twice",
+				"argument 1 has type string, expected int",
+			},
+		},
+		{
+			name:   "Pipes are checked as calls",
+			input:  "let double = fn(x: int): int => x * 2\nlet add = fn(a: int, b: int): int => a + b\nlet n: int = 5 |> add(3) |> double\nlet s: string = 5 |> double\n\"a\" |> double\n1 |> add(2, 3)",
+			strict: true,
+			errors: []string{
+				"type mismatch: variable s declared as string but assigned int",
+				"argument 0 has type string, expected int",
+				"function expects 2 arguments, got 3",
+			},
+		},
+		{
+			name:   "Try and catch are typed",
+			input:  "let d = {\"a\": 1}\nlet v: int = try { d[\"b\"] } catch e { 0 }\nlet m: string = try { \"x\" } catch e { e.message }\nlet e2: error = error(\"oops\")\nfn check(n: int): int => if n < 0 then throw(\"negative\") else n",
+			strict: true,
+		},
+		{
+			name:   "Try and catch errors",
+			input:  "let a = try { 1 } catch e { \"x\" }\nlet b = error(\"x\").code\nlet c = error(1)",
+			strict: true,
+			errors: []string{
+				"try and catch must have same type: try=int, catch=string",
+				"error has no field code",
+				"argument 0 has type int, expected string",
+			},
+		},
+		{
+			name:   "Collection builtins are typed",
+			input:  "let xs = [3, 1, 2]\nlet d = {\"a\": 1}\nlet n: int = len(xs) + len(d) + len(\"abc\")\nlet ys: [int] = push(xs, 4)\nlet zs: [string] = push([], \"x\")\nlet s: string = slice(\"abc\", 1)\nlet ks: [string] = keys(d)\nlet vs: [int] = values(d)\nlet es: [(string, int)] = entries(d)\nlet b: bool = contains(xs, 1) && contains(d, \"a\") && contains(\"abc\", \"b\")\nlet r: [int] = range(1, 10, 2)",
+			strict: true,
+		},
+		{
+			name:   "Collection builtin errors",
+			input:  "let xs = [1]\npush(xs, \"a\")\nlen(5)\nlet ks: [int] = keys({\"a\": 1})\nrange(1, 2, 3, 4)",
+			strict: true,
+			errors: []string{
+				"cannot call push with ([int], string), expected fn([a], a) -> [a]",
+				"cannot call len with (int), expected fn([a]) -> int | fn({k: v}) -> int | fn(string) -> int",
+				"type mismatch: variable ks declared as [int] but assigned [string]",
+				"cannot call range with (int, int, int, int), expected fn(int) -> [int] | fn(int, int) -> [int] | fn(int, int, int) -> [int]",
+			},
+		},
+		{
+			name:   "Higher-order builtins are typed",
+			input:  "let xs = [3, 1, 2]\nlet ss: [string] = map(xs, fn(x) => if x > 1 then \"big\" else \"small\")\nlet ys: [int] = filter(xs, fn(x) => x > 1)\nlet total: int = reduce(xs, 0, fn(acc, x) => acc + x)\nlet b: bool = any(xs, fn(x) => x == 2) && all(xs, fn(x) => x > 0)\nlet f: int = find(xs, fn(x) => x < 3)\nlet zs: [int] = sort(sort(xs), fn(a, c) => c - a)\nlet ps: [(int, string)] = zip(xs, [\"a\"])\nlet es: [(int, int)] = enumerate(xs)\nlet ns: [int] = [\"a\", \"bc\"] |> map(len)\nlet qs: [int] = xs |> map(fn(x) => x * 2) |> filter(fn(x) => x > 2)",
+			strict: true,
+		},
+		{
+			name:   "Higher-order builtin errors",
+			input:  "let xs = [1, 2]\nlet ys: [string] = map(xs, fn(x) => x * 2)\nfilter(xs, fn(x) => x + 1)\nsort(xs, fn(a, b) => a < b)\nmap(xs, fn(x) => x.name)",
+			strict: true,
+			errors: []string{
+				"type mismatch: variable ys declared as [string] but assigned [int]",
+				"cannot call filter with ([int], fn(int) -> int), expected fn([a], fn(a) -> bool) -> [a]",
+				"cannot call sort with ([int], fn(int, int) -> bool), expected fn([a]) -> [a] | fn([a], fn(a, a) -> int) -> [a]",
+				"cannot access field name of int",
+			},
+		},
+		{
+			name:   "String builtins are typed",
+			input:  "let parts: [string] = split(trim(\" a b \"), \" \")\nlet s: string = join(parts, \",\") + upper(\"a\") + lower(\"B\") + replace(\"a\", \"a\", \"b\")\nlet b: bool = startsWith(s, \"a\") || endsWith(s, \"b\")\nlet i: int = indexOf(s, \"b\")\nlet t: string = substring(s, 1) + substring(s, 0, 1) + repeat(\"-\", 3) + padLeft(\"1\", 3, \"0\") + padRight(\"x\", 2)\nlet cs: [string] = chars(s)\nlet f: string = format(\"{} {}\", 1, true) + sprintf(\"%d\", 2)",
+			strict: true,
+		},
+		{
+			name:   "String builtin errors",
+			input:  "split(\"a\", 1)\nlet n: int = upper(\"a\")\njoin([1], \",\")\nformat(1)",
+			strict: true,
+			errors: []string{
+				"cannot call split with (string, int), expected fn(string, string) -> [string]",
+				"type mismatch: variable n declared as int but assigned string",
+				"cannot call join with ([int], string), expected fn([string], string) -> string",
+				"argument 0 has type int, expected string",
+			},
+		},
+		{
+			name:   "Conversion builtins are typed",
+			input:  "let s: string = \"n\" + str(1) + str([1]) + typeof(1)\nlet n: int = int(\"1\") + int(1.5) + int(true)\nlet b: bool = bool(\"true\") && bool(1)\nlet p = parseInt(\"1\")\nlet f: float = float(2) * 1.5 + float(\"1\") + float(true)",
+			strict: true,
+		},
+		{
+			name:  "Values are not converted implicitly",
+			input: "let s = \"n\" + 1\nlet t: string = 5\nvar u = \"a\"\nu = true\nint([1])",
+			errors: []string{
+				"invalid operands for +: string and int (use str to convert)",
+				"type mismatch: variable t declared as string but assigned int",
+				"type mismatch: cannot assign bool to variable u of type string",
+				"cannot call int with ([int]), expected fn(int) -> int | fn(float) -> int | fn(bool) -> int | fn(string) -> int",
+			},
+		},
+		{
+			name:  "Block let bindings are typed",
+			input: "let f = fn(a: int) => {\n let b = a * 2\n let s: string = \"b\"\n b + 1\n}\nlet r: int = f(1)",
+		},
+		{
+			name:   "Block let bindings are local",
+			input:  "let f = fn(a: int) => {\n let b = a * 2\n b\n}\nlet c = b",
+			errors: []string{"undefined variable: b"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prog, err := parser.Parse(tt.input)
+			if err != nil {
+				t.Fatalf("Parse error: %v", err)
+			}
+			tc := types.NewTypeCheckerWithConfig(types.TypeCheckingMode{
+				Strict:  tt.strict,
+				Enabled: true,
+			})
+			tc.CheckProgram(prog)
+
+			if strings.Join(tc.GetErrors(), "\n") != strings.Join(tt.errors, "\n") {
+				t.Errorf("Expected errors %q, got %q", tt.errors, tc.GetErrors())
+			}
+			if strings.Join(tc.GetWarnings(), "\n") != strings.Join(tt.warnings, "\n") {
+				t.Errorf("Expected warnings %q, got %q", tt.warnings, tc.GetWarnings())
+			}
+		})
+	}
+}
@@ -16,21 +16,34 @@ type FluxType interface {
 // Basic types
 type (
 	IntType    struct{}
+	FloatType  struct{}
 	StringType struct{}
 	BoolType   struct{}
 	VoidType   struct{}
 )
 
 func (IntType) String() string    { return "int" }
+func (FloatType) String() string  { return "float" }
 func (StringType) String() string { return "string" }
 func (BoolType) String() string   { return "bool" }
 func (VoidType) String() string   { return "void" }
 
 func (t IntType) Equals(other FluxType) bool    { _, ok := other.(IntType); return ok }
+func (t FloatType) Equals(other FluxType) bool  { _, ok := other.(FloatType); return ok }
 func (t StringType) Equals(other FluxType) bool { _, ok := other.(StringType); return ok }
 func (t BoolType) Equals(other FluxType) bool   { _, ok := other.(BoolType); return ok }
 func (t VoidType) Equals(other FluxType) bool   { _, ok := other.(VoidType); return ok }
 
+// ErrorType is the type of error values, which catch binds and error(msg)
+// makes.
+type ErrorType struct{}
+
+func (ErrorType) String() string { return "error" }
+func (t ErrorType) Equals(other FluxType) bool {
+	_, ok := other.(ErrorType)
+	return ok
+}
+
 // Composite types
 type ListType struct {
 	ElementType FluxType
@@ -66,6 +79,13 @@ func (t DictType) Equals(other FluxType) bool {
 type FunctionType struct {
 	ParamTypes []FluxType
 	ReturnType FluxType
+	// Parameter names and which parameters have defaults, known for
+	// functions defined in the program but not for annotated types
+	ParamNames []string
+	HasDefault []bool
+	// A variadic function collects extra arguments into its last
+	// parameter, which has a list type
+	Variadic bool
 }
 
 func (t FunctionType) String() string {
@@ -73,12 +93,15 @@ func (t FunctionType) String() string {
 	for i, p := range t.ParamTypes {
 		params[i] = p.String()
 	}
+	if t.Variadic {
+		params[len(params)-1] = "..." + params[len(params)-1]
+	}
 	return fmt.Sprintf("fn(%s) -> %s", strings.Join(params, ", "), t.ReturnType.String())
 }
 
 func (t FunctionType) Equals(other FluxType) bool {
 	if otherFunc, ok := other.(FunctionType); ok {
-		if len(t.ParamTypes) != len(otherFunc.ParamTypes) {
+		if len(t.ParamTypes) != len(otherFunc.ParamTypes) || t.Variadic != otherFunc.Variadic {
 			return false
 		}
 		for i, param := range t.ParamTypes {
@@ -91,6 +114,119 @@ func (t FunctionType) Equals(other FluxType) bool {
 	return false
 }
 
+func (t FunctionType) paramIndex(name string) int {
+	for i, param := range t.ParamNames {
+		if param == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func (t FunctionType) hasDefault(i int) bool {
+	return i < len(t.HasDefault) && t.HasDefault[i]
+}
+
+func (t FunctionType) hasDefaults() bool {
+	for _, d := range t.HasDefault {
+		if d {
+			return true
+		}
+	}
+	return false
+}
+
+// TupleType is the type of a fixed-size tuple, such as (int, string).
+type TupleType struct {
+	ElemTypes []FluxType
+}
+
+func (t TupleType) String() string {
+	elems := make([]string, len(t.ElemTypes))
+	for i, e := range t.ElemTypes {
+		elems[i] = e.String()
+	}
+	return fmt.Sprintf("(%s)", strings.Join(elems, ", "))
+}
+
+func (t TupleType) Equals(other FluxType) bool {
+	if otherTuple, ok := other.(TupleType); ok {
+		if len(t.ElemTypes) != len(otherTuple.ElemTypes) {
+			return false
+		}
+		for i, elem := range t.ElemTypes {
+			if !TypesEqual(elem, otherTuple.ElemTypes[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// RecordType is a type declared with type Name = { field: type, ... }.
+// Records are nominal: two record types are equal when their names are.
+type RecordType struct {
+	Name   string
+	Fields []RecordField
+}
+
+type RecordField struct {
+	Name string
+	Type FluxType
+}
+
+func (t RecordType) String() string { return t.Name }
+
+func (t RecordType) Equals(other FluxType) bool {
+	if otherRecord, ok := other.(RecordType); ok {
+		return t.Name == otherRecord.Name
+	}
+	return false
+}
+
+// Field returns the type of the named field.
+func (t RecordType) Field(name string) (FluxType, bool) {
+	for _, field := range t.Fields {
+		if field.Name == name {
+			return field.Type, true
+		}
+	}
+	return nil, false
+}
+
+// VariantType is a sum type declared with type Name = A(T, ...) | B | ....
+// Like records, sum types are nominal.
+type VariantType struct {
+	Name     string
+	Variants []Variant
+}
+
+// Variant is one constructor of a sum type and the types of its arguments.
+type Variant struct {
+	Name   string
+	Fields []FluxType
+}
+
+func (t VariantType) String() string { return t.Name }
+
+func (t VariantType) Equals(other FluxType) bool {
+	if otherVariant, ok := other.(VariantType); ok {
+		return t.Name == otherVariant.Name
+	}
+	return false
+}
+
+// Variant returns the named constructor.
+func (t VariantType) Variant(name string) (Variant, bool) {
+	for _, variant := range t.Variants {
+		if variant.Name == name {
+			return variant, true
+		}
+	}
+	return Variant{}, false
+}
+
 // Add a new type for unknown/inferred types
 type UnknownType struct{}
 
@@ -107,21 +243,48 @@ func TypesEqual(a, b FluxType) bool {
 	return a.Equals(b) || b.Equals(a)
 }
 
+// isUnknown reports whether t is the unknown type. TypesEqual cannot be used
+// for this, since the unknown type is equal to every type.
+func isUnknown(t FluxType) bool {
+	_, ok := t.(UnknownType)
+	return ok
+}
+
 // Type environment for variable bindings
 type TypeEnv struct {
 	bindings map[string]FluxType
-	parent   *TypeEnv
+	// Names bound with var, which may be reassigned
+	mutable map[string]bool
+	parent  *TypeEnv
 }
 
 func NewTypeEnv(parent *TypeEnv) *TypeEnv {
 	return &TypeEnv{
 		bindings: make(map[string]FluxType),
+		mutable:  make(map[string]bool),
 		parent:   parent,
 	}
 }
 
 func (env *TypeEnv) Bind(name string, t FluxType) {
 	env.bindings[name] = t
+	delete(env.mutable, name)
+}
+
+// BindMutable binds a name that may later be reassigned.
+func (env *TypeEnv) BindMutable(name string, t FluxType) {
+	env.bindings[name] = t
+	env.mutable[name] = true
+}
+
+// IsMutable reports whether the nearest binding of name was made with var.
+func (env *TypeEnv) IsMutable(name string) bool {
+	for scope := env; scope != nil; scope = scope.parent {
+		if _, ok := scope.bindings[name]; ok {
+			return scope.mutable[name]
+		}
+	}
+	return false
 }
 
 func (env *TypeEnv) Lookup(name string) (FluxType, bool) {
@@ -140,6 +303,13 @@ type TypeChecker struct {
 	errors   []string
 	warnings []string
 	config   TypeCheckingMode
+	// Types declared by the program, by name
+	typeDefs map[string]FluxType
+	// Sum types by the name of each of their constructors
+	constructors map[string]VariantType
+	// Number of loops enclosing the expression being checked, within the
+	// current function
+	loopDepth int
 }
 
 // TypeCheckingMode controls how strict the type checker is
@@ -161,16 +331,159 @@ func NewTypeCheckerWithConfig(mode TypeCheckingMode) *TypeChecker {
 	env := NewTypeEnv(nil)
 
 	// Add built-in functions with more flexible typing
-	env.Bind("print", FunctionType{
-		ParamTypes: []FluxType{UnknownType{}}, // Accept any type
-		ReturnType: VoidType{},
+	// print and println accept any number of values of any type
+	for _, name := range []string{"print", "println"} {
+		env.Bind(name, FunctionType{
+			ParamTypes: []FluxType{ListType{ElementType: UnknownType{}}},
+			ReturnType: VoidType{},
+			Variadic:   true,
+		})
+	}
+	// format and sprintf take a template followed by any number of values
+	for _, name := range []string{"format", "sprintf"} {
+		env.Bind(name, FunctionType{
+			ParamTypes: []FluxType{StringType{}, ListType{ElementType: UnknownType{}}},
+			ReturnType: StringType{},
+			Variadic:   true,
+		})
+	}
+	env.Bind("error", FunctionType{
+		ParamTypes: []FluxType{StringType{}},
+		ReturnType: ErrorType{},
+	})
+	// throw never returns, so a call to it fits wherever a value is expected
+	env.Bind("throw", FunctionType{
+		ParamTypes: []FluxType{UnknownType{}},
+		ReturnType: UnknownType{},
 	})
 
+	// Collection builtins. The type variables stand for any type and are
+	// bound by the arguments of each call.
+	a, b, k, v := TypeVar{Name: "a"}, TypeVar{Name: "b"}, TypeVar{Name: "k"}, TypeVar{Name: "v"}
+	list, dict := ListType{ElementType: a}, DictType{KeyType: k, ValueType: v}
+	pred := fnType(BoolType{}, a)
+	str, strs := StringType{}, ListType{ElementType: StringType{}}
+	builtins := []BuiltinType{
+		{Name: "len", Signatures: []FunctionType{
+			fnType(IntType{}, list),
+			fnType(IntType{}, dict),
+			fnType(IntType{}, StringType{}),
+		}},
+		{Name: "push", Signatures: []FunctionType{
+			fnType(list, list, a),
+		}},
+		{Name: "slice", Signatures: []FunctionType{
+			fnType(list, list, IntType{}),
+			fnType(list, list, IntType{}, IntType{}),
+			fnType(StringType{}, StringType{}, IntType{}),
+			fnType(StringType{}, StringType{}, IntType{}, IntType{}),
+		}},
+		{Name: "keys", Signatures: []FunctionType{
+			fnType(ListType{ElementType: k}, dict),
+		}},
+		{Name: "values", Signatures: []FunctionType{
+			fnType(ListType{ElementType: v}, dict),
+		}},
+		{Name: "entries", Signatures: []FunctionType{
+			fnType(ListType{ElementType: TupleType{ElemTypes: []FluxType{k, v}}}, dict),
+		}},
+		{Name: "contains", Signatures: []FunctionType{
+			fnType(BoolType{}, list, a),
+			fnType(BoolType{}, dict, k),
+			fnType(BoolType{}, StringType{}, StringType{}),
+		}},
+		{Name: "range", Signatures: []FunctionType{
+			fnType(ListType{ElementType: IntType{}}, IntType{}),
+			fnType(ListType{ElementType: IntType{}}, IntType{}, IntType{}),
+			fnType(ListType{ElementType: IntType{}}, IntType{}, IntType{}, IntType{}),
+		}},
+		{Name: "map", Signatures: []FunctionType{
+			fnType(ListType{ElementType: b}, list, fnType(b, a)),
+		}},
+		{Name: "filter", Signatures: []FunctionType{
+			fnType(list, list, pred),
+		}},
+		{Name: "reduce", Signatures: []FunctionType{
+			fnType(b, list, b, fnType(b, b, a)),
+		}},
+		{Name: "any", Signatures: []FunctionType{
+			fnType(BoolType{}, list, pred),
+		}},
+		{Name: "all", Signatures: []FunctionType{
+			fnType(BoolType{}, list, pred),
+		}},
+		{Name: "find", Signatures: []FunctionType{
+			fnType(a, list, pred),
+		}},
+		{Name: "sort", Signatures: []FunctionType{
+			fnType(list, list),
+			fnType(list, list, fnType(IntType{}, a, a)),
+		}},
+		{Name: "zip", Signatures: []FunctionType{
+			fnType(ListType{ElementType: TupleType{ElemTypes: []FluxType{a, b}}}, list, ListType{ElementType: b}),
+		}},
+		{Name: "enumerate", Signatures: []FunctionType{
+			fnType(ListType{ElementType: TupleType{ElemTypes: []FluxType{IntType{}, a}}}, list),
+		}},
+		// String builtins
+		{Name: "split", Signatures: []FunctionType{fnType(strs, str, str)}},
+		{Name: "join", Signatures: []FunctionType{fnType(str, strs, str)}},
+		{Name: "trim", Signatures: []FunctionType{fnType(str, str)}},
+		{Name: "upper", Signatures: []FunctionType{fnType(str, str)}},
+		{Name: "lower", Signatures: []FunctionType{fnType(str, str)}},
+		{Name: "replace", Signatures: []FunctionType{fnType(str, str, str, str)}},
+		{Name: "startsWith", Signatures: []FunctionType{fnType(BoolType{}, str, str)}},
+		{Name: "endsWith", Signatures: []FunctionType{fnType(BoolType{}, str, str)}},
+		{Name: "indexOf", Signatures: []FunctionType{fnType(IntType{}, str, str)}},
+		{Name: "substring", Signatures: []FunctionType{
+			fnType(str, str, IntType{}),
+			fnType(str, str, IntType{}, IntType{}),
+		}},
+		{Name: "repeat", Signatures: []FunctionType{fnType(str, str, IntType{})}},
+		{Name: "padLeft", Signatures: []FunctionType{
+			fnType(str, str, IntType{}),
+			fnType(str, str, IntType{}, str),
+		}},
+		{Name: "padRight", Signatures: []FunctionType{
+			fnType(str, str, IntType{}),
+			fnType(str, str, IntType{}, str),
+		}},
+		{Name: "chars", Signatures: []FunctionType{fnType(strs, str)}},
+		// Conversions. parseInt returns an int or an error value, which
+		// only typeof can tell apart, so its result is unknown.
+		{Name: "str", Signatures: []FunctionType{fnType(str, a)}},
+		{Name: "int", Signatures: []FunctionType{
+			fnType(IntType{}, IntType{}),
+			fnType(IntType{}, FloatType{}),
+			fnType(IntType{}, BoolType{}),
+			fnType(IntType{}, str),
+		}},
+		{Name: "float", Signatures: []FunctionType{
+			fnType(FloatType{}, FloatType{}),
+			fnType(FloatType{}, IntType{}),
+			fnType(FloatType{}, BoolType{}),
+			fnType(FloatType{}, str),
+		}},
+		{Name: "parseInt", Signatures: []FunctionType{fnType(UnknownType{}, str)}},
+		{Name: "bool", Signatures: []FunctionType{
+			fnType(BoolType{}, BoolType{}),
+			fnType(BoolType{}, IntType{}),
+			fnType(BoolType{}, FloatType{}),
+			fnType(BoolType{}, str),
+		}},
+		{Name: "typeof", Signatures: []FunctionType{fnType(str, a)}},
+	}
+	for _, builtin := range builtins {
+		env.Bind(builtin.Name, builtin)
+	}
+
 	return &TypeChecker{
-		env:      env,
-		errors:   []string{},
-		warnings: []string{},
-		config:   mode,
+		env:          env,
+		errors:       []string{},
+		warnings:     []string{},
+		config:       mode,
+		typeDefs:     map[string]FluxType{},
+		constructors: map[string]VariantType{},
 	}
 }
 
@@ -204,56 +517,314 @@ func (tc *TypeChecker) HasWarnings() bool {
 
 // Type checking methods
 func (tc *TypeChecker) CheckProgram(prog *ast.Program) {
+	tc.declareTypes(prog)
+	tc.declareFunctions(prog)
 	for _, stmt := range prog.Statements {
 		tc.CheckStatement(stmt)
 	}
 }
 
+// declareTypes registers the type declarations of a program before anything
+// else is checked, so that types can be used before they are declared and
+// can refer to each other. All names are registered first and the field
+// types resolved afterwards; the fields are filled in place, so every copy
+// of a record or sum type sees them. Constructors of sum types are bound as
+// functions, or as values if they take no arguments.
+func (tc *TypeChecker) declareTypes(prog *ast.Program) {
+	var decls []*ast.TypeDecl
+	for _, stmt := range prog.Statements {
+		if stmt.Type == nil {
+			continue
+		}
+		decl := stmt.Type
+		if _, ok := tc.typeDefs[decl.Name]; ok {
+			tc.Error(fmt.Sprintf("type %s is already declared", decl.Name))
+			continue
+		}
+		if decl.Record != nil {
+			tc.typeDefs[decl.Name] = RecordType{
+				Name:   decl.Name,
+				Fields: make([]RecordField, len(decl.Record.Fields)),
+			}
+		} else {
+			sum := VariantType{Name: decl.Name, Variants: make([]Variant, len(decl.Variants))}
+			for _, variant := range decl.Variants {
+				if _, ok := tc.constructors[variant.Name]; ok {
+					tc.Error(fmt.Sprintf("constructor %s is already declared", variant.Name))
+					continue
+				}
+				tc.constructors[variant.Name] = sum
+			}
+			tc.typeDefs[decl.Name] = sum
+		}
+		decls = append(decls, decl)
+	}
+
+	for _, decl := range decls {
+		if decl.Record == nil {
+			tc.declareVariants(decl)
+			continue
+		}
+		record := tc.typeDefs[decl.Name].(RecordType)
+		seen := map[string]bool{}
+		for i, field := range decl.Record.Fields {
+			if seen[field.Name] {
+				tc.Error(fmt.Sprintf("duplicate field %s in type %s", field.Name, decl.Name))
+			}
+			seen[field.Name] = true
+			fieldType, err := tc.convertType(field.Type)
+			if err != nil {
+				tc.Error(fmt.Sprintf("invalid type for field %s of %s: %v", field.Name, decl.Name, err))
+				fieldType = UnknownType{}
+			}
+			record.Fields[i] = RecordField{Name: field.Name, Type: fieldType}
+		}
+	}
+}
+
+func (tc *TypeChecker) declareVariants(decl *ast.TypeDecl) {
+	sum := tc.typeDefs[decl.Name].(VariantType)
+	for i, variant := range decl.Variants {
+		fields := make([]FluxType, len(variant.Fields))
+		for j, field := range variant.Fields {
+			fieldType, err := tc.convertType(field)
+			if err != nil {
+				tc.Error(fmt.Sprintf("invalid type for argument %d of %s: %v", j, variant.Name, err))
+				fieldType = UnknownType{}
+			}
+			fields[j] = fieldType
+		}
+		sum.Variants[i] = Variant{Name: variant.Name, Fields: fields}
+		if tc.constructors[variant.Name].Name != decl.Name {
+			// Already declared by another type
+			continue
+		}
+		if len(fields) == 0 {
+			tc.env.Bind(variant.Name, sum)
+		} else {
+			tc.env.Bind(variant.Name, FunctionType{ParamTypes: fields, ReturnType: sum})
+		}
+	}
+}
+
+// declareFunctions binds the signature of every named function before any
+// body is checked, so that functions can call themselves and each other.
+// A function without a return annotation returns unknown until its own
+// declaration is checked.
+func (tc *TypeChecker) declareFunctions(prog *ast.Program) {
+	declared := map[string]bool{}
+	for _, stmt := range prog.Statements {
+		if stmt.Fn == nil {
+			continue
+		}
+		decl := stmt.Fn
+		if declared[decl.Name] {
+			tc.Error(fmt.Sprintf("function %s is already declared", decl.Name))
+			continue
+		}
+		declared[decl.Name] = true
+
+		fnType := FunctionType{ReturnType: tc.annotatedType(decl.ReturnAnno)}
+		for _, param := range decl.Params {
+			fnType.ParamTypes = append(fnType.ParamTypes, tc.annotatedType(param.TypeAnno))
+			fnType.ParamNames = append(fnType.ParamNames, param.Name)
+			fnType.HasDefault = append(fnType.HasDefault, param.Default != nil)
+			fnType.Variadic = param.Variadic
+		}
+		tc.env.Bind(decl.Name, fnType)
+	}
+}
+
+// annotatedType returns the type of an optional annotation, or unknown if
+// there is none. Invalid annotations are reported when the function is
+// checked.
+func (tc *TypeChecker) annotatedType(anno *ast.TypeAnno) FluxType {
+	if anno == nil {
+		return UnknownType{}
+	}
+	t, err := tc.convertType(anno.Type)
+	if err != nil {
+		return UnknownType{}
+	}
+	return t
+}
+
+// convertType converts a type annotation, resolving the names of declared
+// types.
+func (tc *TypeChecker) convertType(astType *ast.Type) (FluxType, error) {
+	return convertASTType(astType, tc.typeDefs)
+}
+
 func (tc *TypeChecker) CheckStatement(stmt *ast.Statement) {
 	if stmt.Let != nil {
 		exprType := tc.CheckExpr(stmt.Let.Expr)
+		target := "variable " + stmt.Let.Name
+		if stmt.Let.Pattern != nil {
+			target = "let pattern"
+		}
 
 		// Check if there's a type annotation
 		if stmt.Let.TypeAnno != nil {
-			annotatedType, err := ConvertASTType(stmt.Let.TypeAnno.Type)
+			annotatedType, err := tc.convertType(stmt.Let.TypeAnno.Type)
 			if err != nil {
 				tc.Error(fmt.Sprintf("invalid type annotation: %v", err))
 				return
 			}
 
 			// Check if the expression type matches the annotation
+			// Values are never converted implicitly, so a mismatch is an
+			// error in every mode; str, int and bool convert explicitly
 			if !TypesEqual(exprType, annotatedType) {
-				msg := fmt.Sprintf("type mismatch: variable %s declared as %s but assigned %s",
-					stmt.Let.Name, annotatedType.String(), exprType.String())
-
-				if tc.config.Strict {
-					tc.Error(msg)
-				} else {
-					// In non-strict mode, allow compatible assignments or issue warnings
-					if tc.canAssign(exprType, annotatedType) {
-						tc.Warning(fmt.Sprintf("implicit type conversion: %s to %s for variable %s",
-							exprType.String(), annotatedType.String(), stmt.Let.Name))
-					} else {
-						tc.Error(msg)
-					}
-				}
+				tc.Error(fmt.Sprintf("type mismatch: %s declared as %s but assigned %s",
+					target, annotatedType.String(), exprType.String()))
 			}
 
 			// Use the annotated type for binding
-			tc.env.Bind(stmt.Let.Name, annotatedType)
+			tc.bind(stmt.Let, annotatedType)
 		} else {
 			// Use inferred type
-			tc.env.Bind(stmt.Let.Name, exprType)
+			tc.bind(stmt.Let, exprType)
 		}
+	} else if stmt.Fn != nil {
+		tc.env.Bind(stmt.Fn.Name, tc.CheckFuncExpr(stmt.Fn.Func()))
+	} else if stmt.Assign != nil {
+		tc.CheckAssign(stmt.Expr, stmt.Assign)
 	} else if stmt.Expr != nil {
 		tc.CheckExpr(stmt.Expr)
 	}
 }
 
+// bind binds the name, or the variables of the pattern, of a let statement.
+func (tc *TypeChecker) bind(let *ast.LetStatement, t FluxType) {
+	if let.Pattern != nil {
+		tc.bindPattern(let, t)
+		return
+	}
+	if let.Mutable() {
+		tc.env.BindMutable(let.Name, t)
+	} else {
+		tc.env.Bind(let.Name, t)
+	}
+}
+
+// bindPattern checks a destructuring let against t. The pattern binds its
+// variables in a scratch environment; they are then bound like plain names,
+// so that var makes them mutable.
+func (tc *TypeChecker) bindPattern(let *ast.LetStatement, t FluxType) {
+	patternEnv := NewTypeEnv(tc.env)
+	oldEnv := tc.env
+	tc.env = patternEnv
+	tc.checkPattern(let.Pattern, t)
+	tc.env = oldEnv
+
+	for name, bound := range patternEnv.bindings {
+		if let.Mutable() {
+			tc.env.BindMutable(name, bound)
+		} else {
+			tc.env.Bind(name, bound)
+		}
+	}
+}
+
+// CheckAssign checks an assignment to a variable, to an element of a list
+// or dict, or to a record field. The variable must have been declared with
+// var, and the assigned value must keep its type.
+func (tc *TypeChecker) CheckAssign(target, rhs *ast.Expr) {
+	valueType := tc.CheckExpr(rhs)
+
+	primary := target.AsPrimary()
+	if primary == nil || primary.Base == nil {
+		tc.Error("invalid assignment target")
+		return
+	}
+	var root string
+	if primary.Base.Term != nil && primary.Base.Term.Ident != nil {
+		root = *primary.Base.Term.Ident
+	}
+
+	if len(primary.Postfix) == 0 {
+		if root == "" {
+			tc.Error("invalid assignment target")
+			return
+		}
+		varType, ok := tc.env.Lookup(root)
+		if !ok {
+			tc.Error(fmt.Sprintf("undefined variable: %s", root))
+			return
+		}
+		if !tc.env.IsMutable(root) {
+			tc.Error(fmt.Sprintf("cannot assign to immutable variable %s (declare it with var)", root))
+		}
+		tc.checkAssignedType("variable "+root, varType, valueType)
+		return
+	}
+
+	last := primary.Postfix[len(primary.Postfix)-1]
+	if last.Call != nil {
+		tc.Error("invalid assignment target")
+		return
+	}
+	// Elements and fields of a variable, however deeply nested, can only be
+	// changed through a var
+	reachesRoot := root != ""
+	for _, postfix := range primary.Postfix {
+		reachesRoot = reachesRoot && postfix.Call == nil
+	}
+	if reachesRoot {
+		if _, ok := tc.env.Lookup(root); ok && !tc.env.IsMutable(root) {
+			part := "an element"
+			if last.Field != nil {
+				part = "a field"
+			}
+			tc.Error(fmt.Sprintf("cannot assign to %s of immutable variable %s (declare it with var)", part, root))
+		}
+	}
+	containerType := tc.CheckPrimaryExpr(&ast.PrimaryExpr{
+		Base:    primary.Base,
+		Postfix: primary.Postfix[:len(primary.Postfix)-1],
+	})
+	if last.Field != nil {
+		fieldType := tc.CheckFieldAccess(containerType, last.Field)
+		tc.checkAssignedType(containerType.String()+"."+last.Field.Name, fieldType, valueType)
+		return
+	}
+	elemType := tc.CheckIndexExpr(containerType, last.Index)
+	tc.checkAssignedType("element of "+containerType.String(), elemType, valueType)
+}
+
+// checkAssignedType reports an assignment that would change the type of
+// what it assigns to, following the same rules as let annotations.
+func (tc *TypeChecker) checkAssignedType(what string, targetType, valueType FluxType) {
+	if TypesEqual(targetType, valueType) {
+		return
+	}
+	tc.Error(fmt.Sprintf("type mismatch: cannot assign %s to %s of type %s",
+		valueType.String(), what, targetType.String()))
+}
+
 func (tc *TypeChecker) CheckExpr(expr *ast.Expr) FluxType {
 	switch {
 	case expr.If != nil:
 		return tc.CheckIfExpr(expr.If)
+	case expr.While != nil:
+		return tc.CheckWhileExpr(expr.While)
+	case expr.For != nil:
+		return tc.CheckForExpr(expr.For)
+	case expr.Match != nil:
+		return tc.CheckMatchExpr(expr.Match)
+	case expr.Try != nil:
+		return tc.CheckTryExpr(expr.Try)
+	case expr.Break, expr.Continue:
+		if tc.loopDepth == 0 {
+			if expr.Break {
+				tc.Error("break outside of a loop")
+			} else {
+				tc.Error("continue outside of a loop")
+			}
+		}
+		// Control never continues past break or continue, so they fit
+		// wherever a value of any type is expected
+		return UnknownType{}
 	case expr.Bin != nil:
 		return tc.CheckBinaryExpr(expr.Bin)
 	case expr.Block != nil:
@@ -268,9 +839,283 @@ func (tc *TypeChecker) CheckExpr(expr *ast.Expr) FluxType {
 	}
 }
 
+func (tc *TypeChecker) CheckWhileExpr(while *ast.WhileExpr) FluxType {
+	condType := tc.CheckExpr(while.Cond)
+	if !TypesEqual(condType, BoolType{}) && !isUnknown(condType) {
+		msg := fmt.Sprintf("while condition must be bool, got %s", condType.String())
+		if tc.config.Strict {
+			tc.Error(msg)
+		} else {
+			tc.Warning(msg + " (treating as truthy)")
+		}
+	}
+
+	tc.loopDepth++
+	tc.CheckBlockExpr(while.Body)
+	tc.loopDepth--
+	return VoidType{}
+}
+
+// CheckForExpr binds the loop variable to the element type of a list, the
+// key type of a dict, or int for a range.
+func (tc *TypeChecker) CheckForExpr(loop *ast.ForExpr) FluxType {
+	iterType := tc.CheckExpr(loop.Iter)
+	var elemType FluxType = UnknownType{}
+	if loop.RangeEnd != nil {
+		endType := tc.CheckExpr(loop.RangeEnd)
+		if !TypesEqual(iterType, IntType{}) || !TypesEqual(endType, IntType{}) {
+			tc.Error(fmt.Sprintf("range bounds must be int, got %s and %s", iterType.String(), endType.String()))
+		}
+		elemType = IntType{}
+	} else {
+		switch t := iterType.(type) {
+		case ListType:
+			elemType = t.ElementType
+		case DictType:
+			elemType = t.KeyType
+		case UnknownType:
+		default:
+			tc.Error(fmt.Sprintf("cannot iterate over %s", iterType.String()))
+		}
+	}
+
+	loopEnv := NewTypeEnv(tc.env)
+	oldEnv := tc.env
+	tc.env = loopEnv
+	tc.env.Bind(loop.Var, elemType)
+
+	tc.loopDepth++
+	tc.CheckBlockExpr(loop.Body)
+	tc.loopDepth--
+
+	tc.env = oldEnv
+	return VoidType{}
+}
+
+// CheckMatchExpr checks each arm against the type of the matched value. The
+// arms must all produce the same type, which is the type of the match.
+func (tc *TypeChecker) CheckMatchExpr(match *ast.MatchExpr) FluxType {
+	valueType := tc.CheckExpr(match.Value)
+	if len(match.Arms) == 0 {
+		tc.Error("match has no arms")
+		return VoidType{}
+	}
+
+	var resultType FluxType = UnknownType{}
+	firstArm := 0
+	for i, arm := range match.Arms {
+		armEnv := NewTypeEnv(tc.env)
+		oldEnv := tc.env
+		tc.env = armEnv
+
+		tc.checkPattern(arm.Pattern, valueType)
+		if arm.Guard != nil {
+			guardType := tc.CheckExpr(arm.Guard)
+			if !TypesEqual(guardType, BoolType{}) && !isUnknown(guardType) {
+				msg := fmt.Sprintf("match guard must be bool, got %s", guardType.String())
+				if tc.config.Strict {
+					tc.Error(msg)
+				} else {
+					tc.Warning(msg + " (treating as truthy)")
+				}
+			}
+		}
+		armType := tc.CheckExpr(arm.Body)
+		tc.env = oldEnv
+
+		if isUnknown(armType) {
+			continue
+		}
+		if isUnknown(resultType) {
+			resultType, firstArm = armType, i
+			continue
+		}
+		if !TypesEqual(armType, resultType) {
+			msg := fmt.Sprintf("match arms must have same type: arm %d is %s, arm %d is %s",
+				firstArm+1, resultType.String(), i+1, armType.String())
+			if tc.config.Strict {
+				tc.Error(msg)
+			} else {
+				tc.Warning(msg + " (using the first arm's type)")
+			}
+		}
+	}
+	if sum, ok := valueType.(VariantType); ok {
+		tc.checkExhaustive(sum, match.Arms)
+	}
+	return resultType
+}
+
+// checkExhaustive reports the constructors of a sum type that no arm of a
+// match covers. An arm covers a constructor when it has no guard and all of
+// its arguments are bindings; a binding or _ on its own covers all of them.
+func (tc *TypeChecker) checkExhaustive(sum VariantType, arms []*ast.MatchArm) {
+	covered := map[string]bool{}
+	for _, arm := range arms {
+		if arm.Guard != nil {
+			continue
+		}
+		if tc.isBinding(arm.Pattern) {
+			return
+		}
+		name, args := tc.constructorPattern(arm.Pattern)
+		if name == "" {
+			continue
+		}
+		catchAll := true
+		for _, arg := range args {
+			catchAll = catchAll && tc.isBinding(arg)
+		}
+		if catchAll {
+			covered[name] = true
+		}
+	}
+
+	var missing []string
+	for _, variant := range sum.Variants {
+		if !covered[variant.Name] {
+			missing = append(missing, variant.Name)
+		}
+	}
+	if len(missing) > 0 {
+		tc.Error(fmt.Sprintf("match on %s is not exhaustive: missing %s", sum.Name, strings.Join(missing, ", ")))
+	}
+}
+
+// isBinding reports whether pattern is a binding or _, which match anything.
+// A name that refers to a constructor is not a binding.
+func (tc *TypeChecker) isBinding(pattern *ast.Pattern) bool {
+	if pattern.Binding == nil {
+		return false
+	}
+	_, isConstructor := tc.constructors[*pattern.Binding]
+	return !isConstructor
+}
+
+// constructorPattern returns the constructor and argument patterns of a
+// constructor pattern, or an empty name if pattern is not one.
+func (tc *TypeChecker) constructorPattern(pattern *ast.Pattern) (string, []*ast.Pattern) {
+	if pattern.Constructor != nil {
+		return pattern.Constructor.Name, pattern.Constructor.Args
+	}
+	if pattern.Binding != nil && !tc.isBinding(pattern) {
+		return *pattern.Binding, nil
+	}
+	return "", nil
+}
+
+// checkPattern checks that pattern can match a value of type t and binds the
+// pattern's variables in the current environment.
+func (tc *TypeChecker) checkPattern(pattern *ast.Pattern, t FluxType) {
+	switch {
+	case pattern.Literal != nil:
+		litType := literalType(pattern.Literal)
+		if !TypesEqual(litType, t) && !(isNumeric(litType) && isNumeric(t)) {
+			tc.Error(fmt.Sprintf("pattern type mismatch: %s pattern cannot match %s", litType.String(), t.String()))
+		}
+	case pattern.Constructor != nil || (pattern.Binding != nil && !tc.isBinding(pattern)):
+		tc.checkVariantPattern(pattern, t)
+	case pattern.Binding != nil:
+		if !pattern.IsWildcard() {
+			tc.env.Bind(*pattern.Binding, t)
+		}
+	case pattern.List != nil:
+		var elemType FluxType = UnknownType{}
+		switch lt := t.(type) {
+		case ListType:
+			elemType = lt.ElementType
+		case UnknownType:
+		default:
+			tc.Error(fmt.Sprintf("pattern type mismatch: list pattern cannot match %s", t.String()))
+		}
+		for _, elem := range pattern.List.Elems {
+			tc.checkPattern(elem, elemType)
+		}
+		if rest := pattern.List.Rest; rest != nil && rest.Name != nil && *rest.Name != "_" {
+			tc.env.Bind(*rest.Name, ListType{ElementType: elemType})
+		}
+	case pattern.Tuple != nil:
+		elems := pattern.Tuple.Elems
+		elemTypes := make([]FluxType, len(elems))
+		for i := range elemTypes {
+			elemTypes[i] = UnknownType{}
+		}
+		switch tt := t.(type) {
+		case TupleType:
+			if len(tt.ElemTypes) == len(elems) {
+				elemTypes = tt.ElemTypes
+			} else {
+				tc.Error(fmt.Sprintf("pattern type mismatch: tuple pattern of %d elements cannot match %s", len(elems), t.String()))
+			}
+		case UnknownType:
+		default:
+			tc.Error(fmt.Sprintf("pattern type mismatch: tuple pattern cannot match %s", t.String()))
+		}
+		for i, elem := range elems {
+			tc.checkPattern(elem, elemTypes[i])
+		}
+	case pattern.Dict != nil:
+		var keyType, valueType FluxType = UnknownType{}, UnknownType{}
+		switch dt := t.(type) {
+		case DictType:
+			keyType, valueType = dt.KeyType, dt.ValueType
+		case UnknownType:
+		default:
+			tc.Error(fmt.Sprintf("pattern type mismatch: dict pattern cannot match %s", t.String()))
+		}
+		for _, entry := range pattern.Dict.Entries {
+			if kt := literalType(entry.Key); !TypesEqual(kt, keyType) {
+				tc.Error(fmt.Sprintf("dictionary key must be %s, got %s", keyType.String(), kt.String()))
+			}
+			tc.checkPattern(entry.Value, valueType)
+		}
+	}
+}
+
+// checkVariantPattern checks a pattern such as Rect(w, h) or None against
+// the sum type t and binds the variables of its argument patterns.
+func (tc *TypeChecker) checkVariantPattern(pattern *ast.Pattern, t FluxType) {
+	name, args := tc.constructorPattern(pattern)
+	sum, ok := tc.constructors[name]
+	if !ok {
+		tc.Error(fmt.Sprintf("unknown constructor: %s", name))
+		for _, arg := range args {
+			tc.checkPattern(arg, UnknownType{})
+		}
+		return
+	}
+	if !TypesEqual(sum, t) {
+		tc.Error(fmt.Sprintf("pattern type mismatch: %s pattern cannot match %s", name, t.String()))
+	}
+	variant, _ := sum.Variant(name)
+	if len(args) != len(variant.Fields) {
+		tc.Error(fmt.Sprintf("%s pattern expects %d arguments, got %d", name, len(variant.Fields), len(args)))
+		for _, arg := range args {
+			tc.checkPattern(arg, UnknownType{})
+		}
+		return
+	}
+	for i, arg := range args {
+		tc.checkPattern(arg, variant.Fields[i])
+	}
+}
+
+func literalType(lit *ast.Literal) FluxType {
+	switch {
+	case lit.Float != nil:
+		return FloatType{}
+	case lit.Number != nil:
+		return IntType{}
+	case lit.String != nil:
+		return StringType{}
+	default:
+		return BoolType{}
+	}
+}
+
 func (tc *TypeChecker) CheckIfExpr(ifExpr *ast.IfExpr) FluxType {
 	condType := tc.CheckExpr(ifExpr.Cond)
-	if !TypesEqual(condType, BoolType{}) && !TypesEqual(condType, UnknownType{}) {
+	if !TypesEqual(condType, BoolType{}) && !isUnknown(condType) {
 		msg := fmt.Sprintf("if condition must be bool, got %s", condType.String())
 		if tc.config.Strict {
 			tc.Error(msg)
@@ -282,7 +1127,7 @@ func (tc *TypeChecker) CheckIfExpr(ifExpr *ast.IfExpr) FluxType {
 	thenType := tc.CheckExpr(ifExpr.ThenExpr)
 	elseType := tc.CheckExpr(ifExpr.ElseExpr)
 
-	if !TypesEqual(thenType, elseType) && !TypesEqual(thenType, UnknownType{}) && !TypesEqual(elseType, UnknownType{}) {
+	if !TypesEqual(thenType, elseType) && !isUnknown(thenType) && !isUnknown(elseType) {
 		msg := fmt.Sprintf("if branches must have same type: then=%s, else=%s",
 			thenType.String(), elseType.String())
 
@@ -302,62 +1147,168 @@ func (tc *TypeChecker) CheckIfExpr(ifExpr *ast.IfExpr) FluxType {
 	return thenType
 }
 
+// CheckTryExpr checks the body of a try and its handler, in which the caught
+// error is bound. Like the branches of an if, both must have the same type.
+func (tc *TypeChecker) CheckTryExpr(try *ast.TryExpr) FluxType {
+	bodyType := tc.CheckBlockExpr(try.Body)
+
+	oldEnv := tc.env
+	tc.env = NewTypeEnv(oldEnv)
+	tc.env.Bind(try.Var, ErrorType{})
+	handlerType := tc.CheckBlockExpr(try.Handler)
+	tc.env = oldEnv
+
+	if isUnknown(bodyType) {
+		return handlerType
+	}
+	if !isUnknown(handlerType) && !TypesEqual(bodyType, handlerType) {
+		msg := fmt.Sprintf("try and catch must have same type: try=%s, catch=%s",
+			bodyType.String(), handlerType.String())
+		if tc.config.Strict {
+			tc.Error(msg)
+			return VoidType{}
+		}
+		tc.Warning(msg + " (using the try type)")
+	}
+	return bodyType
+}
+
 func (tc *TypeChecker) CheckBinaryExpr(binExpr *ast.Binary) FluxType {
-	leftType := tc.CheckExpr(&ast.Expr{Primary: binExpr.Left})
+	// Each pipe is checked as the call it stands for
+	if len(binExpr.Pipes) > 0 {
+		return tc.CheckExpr(binExpr.Piped())
+	}
+	leftType := tc.CheckLogicalAnd(binExpr.Left)
+	for _, op := range binExpr.Right {
+		leftType = tc.CheckOperator(op.Operator, leftType, tc.CheckLogicalAnd(op.Right))
+	}
+	return leftType
+}
+
+func (tc *TypeChecker) CheckLogicalAnd(and *ast.LogicalAnd) FluxType {
+	leftType := tc.CheckComparison(and.Left)
+	for _, op := range and.Right {
+		leftType = tc.CheckOperator(op.Operator, leftType, tc.CheckComparison(op.Right))
+	}
+	return leftType
+}
+
+func (tc *TypeChecker) CheckComparison(cmp *ast.Comparison) FluxType {
+	leftType := tc.CheckAdditive(cmp.Left)
+	for _, op := range cmp.Right {
+		leftType = tc.CheckOperator(op.Operator, leftType, tc.CheckAdditive(op.Right))
+	}
+	return leftType
+}
+
+func (tc *TypeChecker) CheckAdditive(add *ast.Additive) FluxType {
+	leftType := tc.CheckMultiplicative(add.Left)
+	for _, op := range add.Right {
+		leftType = tc.CheckOperator(op.Operator, leftType, tc.CheckMultiplicative(op.Right))
+	}
+	return leftType
+}
+
+func (tc *TypeChecker) CheckMultiplicative(mul *ast.Multiplicative) FluxType {
+	leftType := tc.CheckUnary(mul.Left)
+	for _, op := range mul.Right {
+		leftType = tc.CheckOperator(op.Operator, leftType, tc.CheckUnary(op.Right))
+	}
+	return leftType
+}
 
-	if binExpr.Operator == nil || binExpr.Right == nil {
-		return leftType
+func (tc *TypeChecker) CheckUnary(unary *ast.Unary) FluxType {
+	if unary.Operator == nil {
+		return tc.CheckPrimaryExpr(unary.Primary)
 	}
 
-	rightType := tc.CheckExpr(binExpr.Right)
+	operandType := tc.CheckUnary(unary.Operand)
+	switch *unary.Operator {
+	case "!":
+		if !TypesEqual(operandType, BoolType{}) {
+			msg := fmt.Sprintf("invalid operand for !: %s", operandType.String())
+			if tc.config.Strict {
+				tc.Error(msg)
+			} else {
+				tc.Warning(msg + " (treating as truthy)")
+			}
+		}
+		return BoolType{}
+	case "-":
+		if !isNumeric(operandType) && !isUnknown(operandType) {
+			tc.Error(fmt.Sprintf("invalid operand for -: %s", operandType.String()))
+			return IntType{}
+		}
+		return operandType
+	default:
+		tc.Error(fmt.Sprintf("unknown unary operator: %s", *unary.Operator))
+		return VoidType{}
+	}
+}
 
-	switch *binExpr.Operator {
+// CheckOperator returns the result type of applying a binary operator to
+// operands of the given types.
+func (tc *TypeChecker) CheckOperator(operator string, leftType, rightType FluxType) FluxType {
+	switch operator {
+	case "&&", "||":
+		// Short-circuiting yields one of the operands, so bool in means bool out
+		if TypesEqual(leftType, BoolType{}) && TypesEqual(rightType, BoolType{}) {
+			return BoolType{}
+		}
+
+		msg := fmt.Sprintf("invalid operands for %s: %s and %s", operator, leftType.String(), rightType.String())
+		if tc.config.Strict {
+			tc.Error(msg)
+			return BoolType{}
+		}
+		tc.Warning(msg + " (treating as truthy)")
+		if TypesEqual(leftType, rightType) {
+			return leftType
+		}
+		return UnknownType{}
 	case "+":
 		// Allow unknown types for inference
-		if TypesEqual(leftType, UnknownType{}) || TypesEqual(rightType, UnknownType{}) {
+		if isUnknown(leftType) || isUnknown(rightType) {
 			// Try to infer based on the known type
-			if !TypesEqual(leftType, UnknownType{}) {
+			if !isUnknown(leftType) {
 				return leftType
 			}
-			if !TypesEqual(rightType, UnknownType{}) {
+			if !isUnknown(rightType) {
 				return rightType
 			}
 			return UnknownType{} // Both unknown, return unknown
 		}
 
-		if TypesEqual(leftType, IntType{}) && TypesEqual(rightType, IntType{}) {
-			return IntType{}
+		if numType, ok := tc.checkNumeric(operator, leftType, rightType); ok {
+			return numType
 		}
 		if TypesEqual(leftType, StringType{}) && TypesEqual(rightType, StringType{}) {
 			return StringType{}
 		}
 
 		msg := fmt.Sprintf("invalid operands for +: %s and %s", leftType.String(), rightType.String())
-		if tc.config.Strict {
-			tc.Error(msg)
-		} else {
-			// In non-strict mode, be more lenient
-			if (TypesEqual(leftType, IntType{}) || TypesEqual(leftType, StringType{})) &&
-				(TypesEqual(rightType, IntType{}) || TypesEqual(rightType, StringType{})) {
-				tc.Warning(fmt.Sprintf("mixed type addition: %s + %s (converting to string)",
-					leftType.String(), rightType.String()))
-				return StringType{} // Default to string for mixed additions
-			} else {
-				tc.Error(msg)
-			}
+		// + never converts, so adding a string to another type fails at
+		// run time in every mode
+		if TypesEqual(leftType, StringType{}) || TypesEqual(rightType, StringType{}) {
+			msg += " (use str to convert)"
 		}
+		tc.Error(msg)
 		return VoidType{}
-	case "-":
+	case "-", "*", "/", "%":
 		// Allow unknown types for inference
-		if TypesEqual(leftType, UnknownType{}) || TypesEqual(rightType, UnknownType{}) {
-			return IntType{} // Assume int for arithmetic
+		if isUnknown(leftType) || isUnknown(rightType) {
+			// Assume int for arithmetic unless the other operand is a float
+			if isFloat(leftType) || isFloat(rightType) {
+				return FloatType{}
+			}
+			return IntType{}
 		}
 
-		if TypesEqual(leftType, IntType{}) && TypesEqual(rightType, IntType{}) {
-			return IntType{}
+		if numType, ok := tc.checkNumeric(operator, leftType, rightType); ok {
+			return numType
 		}
 
-		msg := fmt.Sprintf("invalid operands for -: %s and %s", leftType.String(), rightType.String())
+		msg := fmt.Sprintf("invalid operands for %s: %s and %s", operator, leftType.String(), rightType.String())
 		if tc.config.Strict {
 			tc.Error(msg)
 		} else {
@@ -365,9 +1316,9 @@ func (tc *TypeChecker) CheckBinaryExpr(binExpr *ast.Binary) FluxType {
 			return IntType{}
 		}
 		return VoidType{}
-	case "==":
+	case "==", "!=":
 		// Allow comparison of unknown types
-		if TypesEqual(leftType, UnknownType{}) || TypesEqual(rightType, UnknownType{}) {
+		if isUnknown(leftType) || isUnknown(rightType) {
 			return BoolType{}
 		}
 
@@ -382,17 +1333,21 @@ func (tc *TypeChecker) CheckBinaryExpr(binExpr *ast.Binary) FluxType {
 			tc.Warning(msg + " (allowing comparison)")
 		}
 		return BoolType{}
-	case ">", "<":
+	case ">", "<", ">=", "<=":
 		// Allow unknown types for comparison
-		if TypesEqual(leftType, UnknownType{}) || TypesEqual(rightType, UnknownType{}) {
+		if isUnknown(leftType) || isUnknown(rightType) {
 			return BoolType{}
 		}
 
-		if TypesEqual(leftType, IntType{}) && TypesEqual(rightType, IntType{}) {
+		// Numbers order numerically, strings lexicographically
+		if _, ok := tc.checkNumeric(operator, leftType, rightType); ok {
+			return BoolType{}
+		}
+		if TypesEqual(leftType, StringType{}) && TypesEqual(rightType, StringType{}) {
 			return BoolType{}
 		}
 
-		msg := fmt.Sprintf("invalid operands for %s: %s and %s", *binExpr.Operator, leftType.String(), rightType.String())
+		msg := fmt.Sprintf("invalid operands for %s: %s and %s", operator, leftType.String(), rightType.String())
 		if tc.config.Strict {
 			tc.Error(msg)
 		} else {
@@ -400,16 +1355,70 @@ func (tc *TypeChecker) CheckBinaryExpr(binExpr *ast.Binary) FluxType {
 		}
 		return BoolType{}
 	default:
-		tc.Error(fmt.Sprintf("unknown binary operator: %s", *binExpr.Operator))
+		tc.Error(fmt.Sprintf("unknown binary operator: %s", operator))
 		return VoidType{}
 	}
 }
 
+// checkNumeric types an operator applied to two numbers, reporting false if
+// either operand is not numeric. Mixing int and float widens the int to a
+// float in lenient mode and is an error in strict mode.
+func (tc *TypeChecker) checkNumeric(operator string, leftType, rightType FluxType) (FluxType, bool) {
+	if !isNumeric(leftType) || !isNumeric(rightType) {
+		return nil, false
+	}
+	if TypesEqual(leftType, rightType) {
+		return leftType, true
+	}
+
+	msg := fmt.Sprintf("mixed int and float operands for %s: %s and %s", operator, leftType.String(), rightType.String())
+	if tc.config.Strict {
+		tc.Error(msg + " (convert explicitly)")
+	} else {
+		tc.Warning(msg + " (widening int to float)")
+	}
+	return FloatType{}, true
+}
+
+func isNumeric(t FluxType) bool {
+	switch t.(type) {
+	case IntType, FloatType:
+		return true
+	}
+	return false
+}
+
+func isFloat(t FluxType) bool {
+	_, ok := t.(FloatType)
+	return ok
+}
+
+// CheckBlockExpr checks the statements of a block in a child environment so
+// that its let bindings stay local. A block ending in a let or an
+// assignment is void. Types and named functions can only be declared at the
+// top level.
 func (tc *TypeChecker) CheckBlockExpr(blockExpr *ast.BlockExpr) FluxType {
+	blockEnv := NewTypeEnv(tc.env)
+	oldEnv := tc.env
+	tc.env = blockEnv
+
 	var lastType FluxType = VoidType{}
-	for _, expr := range blockExpr.Exprs {
-		lastType = tc.CheckExpr(expr)
+	for _, stmt := range blockExpr.Statements {
+		if stmt.Type != nil {
+			tc.Error("type declarations must be at the top level")
+			lastType = VoidType{}
+		} else if stmt.Fn != nil {
+			tc.Error("function declarations must be at the top level")
+			lastType = VoidType{}
+		} else if stmt.Let != nil || stmt.Assign != nil {
+			tc.CheckStatement(stmt)
+			lastType = VoidType{}
+		} else {
+			lastType = tc.CheckExpr(stmt.Expr)
+		}
 	}
+
+	tc.env = oldEnv
 	return lastType
 }
 
@@ -427,6 +1436,8 @@ func (tc *TypeChecker) CheckPrimaryExpr(primary *ast.PrimaryExpr) FluxType {
 			currentType = tc.CheckCallExpr(currentType, postfix.Call)
 		} else if postfix.Index != nil {
 			currentType = tc.CheckIndexExpr(currentType, postfix.Index)
+		} else if postfix.Field != nil {
+			currentType = tc.CheckFieldAccess(currentType, postfix.Field)
 		}
 	}
 
@@ -434,12 +1445,22 @@ func (tc *TypeChecker) CheckPrimaryExpr(primary *ast.PrimaryExpr) FluxType {
 }
 
 func (tc *TypeChecker) CheckBaseExpr(base *ast.BaseExpr) FluxType {
-	if base.Term != nil {
+	if base.Record != nil {
+		return tc.CheckRecordLit(base.Record)
+	} else if base.Term != nil {
 		return tc.CheckTerm(base.Term)
 	} else if base.List != nil {
 		return tc.CheckListExpr(base.List)
 	} else if base.Dict != nil {
 		return tc.CheckDictExpr(base.Dict)
+	} else if base.Paren != nil && base.Paren.IsTuple() {
+		var elemTypes []FluxType
+		for _, elem := range base.Paren.Elems() {
+			elemTypes = append(elemTypes, tc.CheckExpr(elem))
+		}
+		return TupleType{ElemTypes: elemTypes}
+	} else if base.Paren != nil {
+		return tc.CheckExpr(base.Paren.Expr)
 	}
 
 	tc.Error("unknown base expression")
@@ -447,10 +1468,19 @@ func (tc *TypeChecker) CheckBaseExpr(base *ast.BaseExpr) FluxType {
 }
 
 func (tc *TypeChecker) CheckTerm(term *ast.Term) FluxType {
-	if term.Number != nil {
+	if term.Float != nil {
+		return FloatType{}
+	} else if term.Number != nil {
 		return IntType{}
 	} else if term.String != nil {
 		return StringType{}
+	} else if term.Interp != nil {
+		// Embedded expressions of any type are stringified
+		_, exprs := term.Interp.Fragments()
+		for _, e := range exprs {
+			tc.CheckExpr(e)
+		}
+		return StringType{}
 	} else if term.Bool != nil {
 		return BoolType{}
 	} else if term.Ident != nil {
@@ -467,8 +1497,8 @@ func (tc *TypeChecker) CheckTerm(term *ast.Term) FluxType {
 
 func (tc *TypeChecker) CheckListExpr(list *ast.ListExpr) FluxType {
 	if len(list.Elems) == 0 {
-		// Empty list - we'll infer the type later or use a generic type
-		return ListType{ElementType: VoidType{}}
+		// Empty list - the element type is fixed by whatever it is assigned to
+		return ListType{ElementType: UnknownType{}}
 	}
 
 	elemType := tc.CheckExpr(list.Elems[0])
@@ -485,12 +1515,13 @@ func (tc *TypeChecker) CheckListExpr(list *ast.ListExpr) FluxType {
 
 func (tc *TypeChecker) CheckDictExpr(dict *ast.DictExpr) FluxType {
 	if len(dict.Pairs) == 0 {
-		// Empty dictionary
-		return DictType{KeyType: VoidType{}, ValueType: VoidType{}}
+		// Empty dictionary - like an empty list, compatible with any dict type
+		return DictType{KeyType: UnknownType{}, ValueType: UnknownType{}}
 	}
 
 	keyType := tc.CheckExpr(dict.Pairs[0].Key)
 	valueType := tc.CheckExpr(dict.Pairs[0].Value)
+	tc.checkKeyType(keyType)
 
 	for i, pair := range dict.Pairs[1:] {
 		kt := tc.CheckExpr(pair.Key)
@@ -510,24 +1541,81 @@ func (tc *TypeChecker) CheckDictExpr(dict *ast.DictExpr) FluxType {
 }
 
 func (tc *TypeChecker) CheckCallExpr(fnType FluxType, call *ast.CallExpr) FluxType {
+	// Untyped parameters (e.g. callbacks) may hold any function
+	if _, ok := fnType.(UnknownType); ok {
+		for _, arg := range call.Args {
+			tc.CheckExpr(arg.Value)
+		}
+		return UnknownType{}
+	}
+
+	if builtin, ok := fnType.(BuiltinType); ok {
+		return tc.checkBuiltinCall(builtin, call)
+	}
+
 	funcType, ok := fnType.(FunctionType)
 	if !ok {
 		tc.Error(fmt.Sprintf("cannot call non-function type: %s", fnType.String()))
 		return VoidType{}
 	}
 
-	if len(call.Args) != len(funcType.ParamTypes) {
-		tc.Error(fmt.Sprintf("function expects %d arguments, got %d",
-			len(funcType.ParamTypes), len(call.Args)))
+	params := len(funcType.ParamTypes)
+	fixed := params
+	if funcType.Variadic {
+		fixed--
+	}
+	positional := 0
+	for _, arg := range call.Args {
+		if arg.Name == nil {
+			positional++
+		}
+	}
+	if positional > fixed && !funcType.Variadic {
+		if funcType.hasDefaults() {
+			tc.Error(fmt.Sprintf("function expects at most %d arguments, got %d", params, len(call.Args)))
+		} else {
+			tc.Error(fmt.Sprintf("function expects %d arguments, got %d", params, len(call.Args)))
+		}
 		return funcType.ReturnType
 	}
 
+	// Match arguments to parameters the way calls do at run time
+	given := make([]bool, params)
+	named := false
 	for i, arg := range call.Args {
-		argType := tc.CheckExpr(arg)
-		expectedType := funcType.ParamTypes[i]
+		argType := tc.CheckExpr(arg.Value)
+		var expectedType FluxType
+		switch {
+		case arg.Name != nil:
+			named = true
+			idx := funcType.paramIndex(*arg.Name)
+			if idx < 0 {
+				tc.Error(fmt.Sprintf("no parameter named %s", *arg.Name))
+				continue
+			}
+			if given[idx] {
+				tc.Error(fmt.Sprintf("parameter %s given twice", *arg.Name))
+				continue
+			}
+			given[idx] = true
+			expectedType = funcType.ParamTypes[idx]
+		case named:
+			tc.Error("positional argument after named argument")
+			continue
+		case i < fixed:
+			given[i] = true
+			expectedType = funcType.ParamTypes[i]
+		default:
+			// Extra arguments of a variadic function are list elements
+			given[fixed] = true
+			expectedType = UnknownType{}
+			if list, ok := funcType.ParamTypes[fixed].(ListType); ok {
+				expectedType = list.ElementType
+			}
+		}
 
 		// Allow unknown types to be compatible
-		if !TypesEqual(expectedType, UnknownType{}) && !TypesEqual(argType, UnknownType{}) {
+		if !isUnknown(expectedType) && !isUnknown(argType) {
 			if !TypesEqual(argType, expectedType) {
 				tc.Error(fmt.Sprintf("argument %d has type %s, expected %s",
 					i, argType.String(), expectedType.String()))
@@ -535,6 +1623,17 @@ func (tc *TypeChecker) CheckCallExpr(fnType FluxType, call *ast.CallExpr) FluxTy
 		}
 	}
 
+	for i := 0; i < fixed; i++ {
+		if !given[i] && !funcType.hasDefault(i) {
+			if funcType.ParamNames != nil {
+				tc.Error(fmt.Sprintf("missing argument for parameter %s", funcType.ParamNames[i]))
+			} else {
+				tc.Error(fmt.Sprintf("function expects %d arguments, got %d", params, len(call.Args)))
+			}
+			break
+		}
+	}
+
 	return funcType.ReturnType
 }
 
@@ -551,40 +1650,154 @@ func (tc *TypeChecker) CheckIndexExpr(baseType FluxType, index *ast.IndexExpr) F
 		if !TypesEqual(indexType, bt.KeyType) {
 			tc.Error(fmt.Sprintf("dictionary key must be %s, got %s",
 				bt.KeyType.String(), indexType.String()))
+		} else {
+			tc.checkKeyType(indexType)
 		}
 		return bt.ValueType
+	case UnknownType:
+		return UnknownType{}
 	default:
 		tc.Error(fmt.Sprintf("cannot index into type: %s", baseType.String()))
 		return VoidType{}
 	}
 }
 
+// checkKeyType reports a dict key type whose values cannot be hashed:
+// lists, tuples and dicts are compared by their elements, so they cannot
+// be used as keys.
+func (tc *TypeChecker) checkKeyType(t FluxType) {
+	switch t.(type) {
+	case ListType, TupleType, DictType:
+		tc.Error(fmt.Sprintf("dictionary key cannot be of type %s", t.String()))
+	}
+}
+
+// CheckRecordLit checks a record literal against its type declaration:
+// every field must be given exactly once, with a value of the field's type.
+func (tc *TypeChecker) CheckRecordLit(lit *ast.RecordLit) FluxType {
+	t, ok := tc.typeDefs[lit.Name]
+	if !ok {
+		tc.Error(fmt.Sprintf("unknown type: %s", lit.Name))
+		for _, field := range lit.Fields {
+			tc.CheckExpr(field.Value)
+		}
+		return UnknownType{}
+	}
+	record := t.(RecordType)
+
+	given := map[string]bool{}
+	for _, field := range lit.Fields {
+		valueType := tc.CheckExpr(field.Value)
+		fieldType, ok := record.Field(field.Name)
+		if !ok {
+			tc.Error(fmt.Sprintf("%s has no field %s", record.Name, field.Name))
+			continue
+		}
+		if given[field.Name] {
+			tc.Error(fmt.Sprintf("field %s given twice in %s literal", field.Name, record.Name))
+		}
+		given[field.Name] = true
+		tc.checkAssignedType(record.Name+"."+field.Name, fieldType, valueType)
+	}
+	for _, field := range record.Fields {
+		if !given[field.Name] {
+			tc.Error(fmt.Sprintf("missing field %s in %s literal", field.Name, record.Name))
+		}
+	}
+	return record
+}
+
+// CheckFieldAccess checks a .name postfix applied to a value of baseType.
+func (tc *TypeChecker) CheckFieldAccess(baseType FluxType, access *ast.FieldAccess) FluxType {
+	switch bt := baseType.(type) {
+	case RecordType:
+		if fieldType, ok := bt.Field(access.Name); ok {
+			return fieldType
+		}
+		tc.Error(fmt.Sprintf("%s has no field %s", bt.Name, access.Name))
+		return VoidType{}
+	case ErrorType:
+		if access.Name == "message" {
+			return StringType{}
+		}
+		tc.Error(fmt.Sprintf("error has no field %s", access.Name))
+		return VoidType{}
+	case UnknownType:
+		return UnknownType{}
+	default:
+		tc.Error(fmt.Sprintf("cannot access field %s of %s", access.Name, baseType.String()))
+		return VoidType{}
+	}
+}
+
 func (tc *TypeChecker) CheckFuncExpr(funcExpr *ast.FuncExpr) FluxType {
+	return tc.checkFuncExpr(funcExpr, nil)
+}
+
+// checkFuncExpr checks a function literal whose unannotated parameters are
+// expected to have the given types, such as a callback passed to a builtin.
+// Parameters past the end of expected are inferred as unknown.
+func (tc *TypeChecker) checkFuncExpr(funcExpr *ast.FuncExpr, expected []FluxType) FluxType {
 	// Create new scope for function parameters
 	funcEnv := NewTypeEnv(tc.env)
 	oldEnv := tc.env
 	tc.env = funcEnv
+	// break and continue cannot reach loops outside the function
+	oldLoopDepth := tc.loopDepth
+	tc.loopDepth = 0
 
 	// Process parameters with type annotations
 	paramTypes := make([]FluxType, len(funcExpr.Params))
+	paramNames := make([]string, len(funcExpr.Params))
+	hasDefault := make([]bool, len(funcExpr.Params))
 	for i, param := range funcExpr.Params {
 		var paramType FluxType
 
 		if param.TypeAnno != nil {
 			// Use explicit type annotation
-			annotatedType, err := ConvertASTType(param.TypeAnno.Type)
+			annotatedType, err := tc.convertType(param.TypeAnno.Type)
 			if err != nil {
 				tc.Error(fmt.Sprintf("invalid type annotation for parameter %s: %v", param.Name, err))
 				paramType = UnknownType{} // fallback
 			} else {
 				paramType = annotatedType
 			}
+		} else if i < len(expected) {
+			paramType = expected[i]
 		} else {
 			// Use unknown type for inference
 			paramType = UnknownType{}
 		}
 
+		if param.Variadic {
+			if i != len(funcExpr.Params)-1 {
+				tc.Error(fmt.Sprintf("variadic parameter %s must be last", param.Name))
+			}
+			if param.TypeAnno == nil {
+				paramType = ListType{ElementType: UnknownType{}}
+			} else if _, ok := paramType.(ListType); !ok && !isUnknown(paramType) {
+				tc.Error(fmt.Sprintf("variadic parameter %s must have a list type, got %s",
+					param.Name, paramType.String()))
+			}
+		}
+
+		// Defaults can refer to the parameters before them
+		if param.Default != nil {
+			if param.Variadic {
+				tc.Error(fmt.Sprintf("variadic parameter %s cannot have a default value", param.Name))
+			}
+			defaultType := tc.CheckExpr(param.Default)
+			if param.TypeAnno == nil {
+				paramType = defaultType
+			} else if !isUnknown(paramType) && !isUnknown(defaultType) && !TypesEqual(defaultType, paramType) {
+				tc.Error(fmt.Sprintf("default value for parameter %s has type %s, expected %s",
+					param.Name, defaultType.String(), paramType.String()))
+			}
+		}
+
 		paramTypes[i] = paramType
+		paramNames[i] = param.Name
+		hasDefault[i] = param.Default != nil
 		tc.env.Bind(param.Name, paramType)
 	}
 
@@ -594,13 +1807,13 @@ func (tc *TypeChecker) CheckFuncExpr(funcExpr *ast.FuncExpr) FluxType {
 	// Check return type annotation if present
 	var returnType FluxType
 	if funcExpr.ReturnAnno != nil {
-		annotatedReturnType, err := ConvertASTType(funcExpr.ReturnAnno.Type)
+		annotatedReturnType, err := tc.convertType(funcExpr.ReturnAnno.Type)
 		if err != nil {
 			tc.Error(fmt.Sprintf("invalid return type annotation: %v", err))
 			returnType = bodyType // use inferred type
 		} else {
 			// Check if body type matches return annotation
-			if !TypesEqual(bodyType, UnknownType{}) && !TypesEqual(bodyType, annotatedReturnType) {
+			if !isUnknown(bodyType) && !TypesEqual(bodyType, annotatedReturnType) {
 				tc.Error(fmt.Sprintf("return type mismatch: declared %s but body returns %s",
 					annotatedReturnType.String(), bodyType.String()))
 			}
@@ -613,30 +1826,13 @@ func (tc *TypeChecker) CheckFuncExpr(funcExpr *ast.FuncExpr) FluxType {
 
 	// Restore old environment
 	tc.env = oldEnv
+	tc.loopDepth = oldLoopDepth
 
 	return FunctionType{
 		ParamTypes: paramTypes,
 		ReturnType: returnType,
-	}
-}
-
-// canAssign checks if a value of one type can be assigned to another in non-strict mode
-func (tc *TypeChecker) canAssign(from, to FluxType) bool {
-	if TypesEqual(from, to) {
-		return true
-	}
-
-	// In non-strict mode, allow some implicit conversions
-	switch to.(type) {
-	case UnknownType:
-		return true
-	case IntType:
-		// Allow string to int conversion in non-strict mode (would need runtime parsing)
-		return false // For now, don't allow this
-	case StringType:
-		// Allow most types to string conversion
-		return true
-	default:
-		return false
+		ParamNames: paramNames,
+		HasDefault: hasDefault,
+		Variadic:   len(funcExpr.Params) > 0 && funcExpr.Params[len(funcExpr.Params)-1].Variadic,
 	}
 }
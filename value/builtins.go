@@ -0,0 +1,141 @@
+package value
+
+import (
+	"io"
+	"strings"
+)
+
+// Builtin is a function provided by the language rather than defined in
+// Flux. Builtins take positional arguments only. Builtins that take
+// functions, such as map, call them through the engine's Caller.
+type Builtin func(call Caller, args []interface{}) interface{}
+
+// Caller calls a Flux function value with positional arguments and returns
+// its result.
+type Caller func(fn interface{}, args ...interface{}) interface{}
+
+func (Builtin) String() string {
+	return "<fn>"
+}
+
+// Builtins are the functions shared by both engines, by name.
+var Builtins = map[string]Builtin{
+	"error":      makeError,
+	"throw":      throw,
+	"len":        length,
+	"push":       push,
+	"slice":      slice,
+	"keys":       keys,
+	"values":     values,
+	"entries":    entries,
+	"contains":   contains,
+	"range":      intRange,
+	"map":        mapList,
+	"filter":     filter,
+	"reduce":     reduce,
+	"any":        anyOf,
+	"all":        allOf,
+	"find":       find,
+	"sort":       sortList,
+	"zip":        zip,
+	"enumerate":  enumerate,
+	"split":      split,
+	"join":       join,
+	"trim":       trim,
+	"upper":      upper,
+	"lower":      lower,
+	"replace":    replace,
+	"startsWith": startsWith,
+	"endsWith":   endsWith,
+	"indexOf":    indexOf,
+	"substring":  substring,
+	"repeat":     repeat,
+	"padLeft":    padLeft,
+	"padRight":   padRight,
+	"chars":      chars,
+	"format":     format,
+	"sprintf":    sprintf,
+	"str":        str,
+	"int":        toInt,
+	"float":      toFloat,
+	"parseInt":   parseIntBuiltin,
+	"bool":       toBool,
+	"typeof":     typeOf,
+}
+
+// makeError makes an error value with a message, without raising it.
+func makeError(_ Caller, args []interface{}) interface{} {
+	checkArgs("error", args, 1)
+	message, ok := args[0].(string)
+	if !ok {
+		panic(Errorf("error expects a string, got %s", kindName(args[0])))
+	}
+	return &Error{Message: message}
+}
+
+// throw raises its argument as a runtime error: an error value is raised as
+// it is, and a string becomes the message of a new error.
+func throw(_ Caller, args []interface{}) interface{} {
+	checkArgs("throw", args, 1)
+	switch e := args[0].(type) {
+	case *Error:
+		panic(e)
+	case string:
+		panic(&Error{Message: e})
+	}
+	panic(Errorf("throw expects a string or an error, got %s", kindName(args[0])))
+}
+
+// Print writes the arguments of print or println to w, separated by spaces
+// and formatted the way interpolation formats them.
+func Print(w io.Writer, args []interface{}, newline bool) {
+	parts := make([]string, len(args))
+	for i, arg := range args {
+		parts[i] = Format(arg)
+	}
+	text := strings.Join(parts, " ")
+	if newline {
+		text += "\n"
+	}
+	io.WriteString(w, text)
+}
+
+func checkArgs(name string, args []interface{}, n int) {
+	if len(args) != n {
+		panic(Errorf("%s expects %d arguments, got %d", name, n, len(args)))
+	}
+}
+
+// checkArgRange is checkArgs for builtins with optional arguments.
+func checkArgRange(name string, args []interface{}, min, max int) {
+	if len(args) < min || len(args) > max {
+		panic(Errorf("%s expects %d to %d arguments, got %d", name, min, max, len(args)))
+	}
+}
+
+// intArg returns argument i of a builtin, which must be an int.
+func intArg(name string, args []interface{}, i int) int {
+	n, ok := args[i].(int)
+	if !ok {
+		panic(Errorf("%s expects an int for argument %d, got %s", name, i+1, kindName(args[i])))
+	}
+	return n
+}
+
+// stringArg returns argument i of a builtin, which must be a string.
+func stringArg(name string, args []interface{}, i int) string {
+	s, ok := args[i].(string)
+	if !ok {
+		panic(Errorf("%s expects a string for argument %d, got %s", name, i+1, kindName(args[i])))
+	}
+	return s
+}
+
+// dictArg returns argument i of a builtin, which must be a dict.
+func dictArg(name string, args []interface{}, i int) map[interface{}]interface{} {
+	d, ok := args[i].(map[interface{}]interface{})
+	if !ok {
+		panic(Errorf("%s expects a dict for argument %d, got %s", name, i+1, kindName(args[i])))
+	}
+	return d
+}
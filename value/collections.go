@@ -0,0 +1,138 @@
+package value
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// length is the len builtin: the number of elements of a list, entries of a
+// dict, or characters of a string.
+func length(_ Caller, args []interface{}) interface{} {
+	checkArgs("len", args, 1)
+	switch c := args[0].(type) {
+	case []interface{}:
+		return len(c)
+	case map[interface{}]interface{}:
+		return len(c)
+	case string:
+		return utf8.RuneCountInString(c)
+	}
+	panic(Errorf("len expects a list, dict or string, got %s", kindName(args[0])))
+}
+
+// push returns a new list with v appended. The list passed in is not
+// changed.
+func push(_ Caller, args []interface{}) interface{} {
+	checkArgs("push", args, 2)
+	list, ok := args[0].([]interface{})
+	if !ok {
+		panic(Errorf("push expects a list, got %s", kindName(args[0])))
+	}
+	result := make([]interface{}, len(list), len(list)+1)
+	copy(result, list)
+	return append(result, args[1])
+}
+
+// slice returns the elements of a list, or the characters of a string, from
+// start up to but not including end, which defaults to the length.
+func slice(_ Caller, args []interface{}) interface{} {
+	checkArgRange("slice", args, 2, 3)
+	var size int
+	switch c := args[0].(type) {
+	case []interface{}:
+		size = len(c)
+	case string:
+		size = utf8.RuneCountInString(c)
+	default:
+		panic(Errorf("slice expects a list or string, got %s", kindName(args[0])))
+	}
+	start, end := intArg("slice", args, 1), size
+	if len(args) == 3 {
+		end = intArg("slice", args, 2)
+	}
+	if start < 0 || end > size || start > end {
+		panic(Errorf("slice bounds %d..%d out of range for length %d", start, end, size))
+	}
+	if s, ok := args[0].(string); ok {
+		return string([]rune(s)[start:end])
+	}
+	result := make([]interface{}, end-start)
+	copy(result, args[0].([]interface{})[start:end])
+	return result
+}
+
+// keys returns the keys of a dict in the order a for loop visits them.
+func keys(_ Caller, args []interface{}) interface{} {
+	checkArgs("keys", args, 1)
+	return Keys(dictArg("keys", args, 0))
+}
+
+// values returns the values of a dict, in the order of their keys.
+func values(_ Caller, args []interface{}) interface{} {
+	checkArgs("values", args, 1)
+	dict := dictArg("values", args, 0)
+	result := Keys(dict)
+	for i, k := range result {
+		result[i] = dict[k]
+	}
+	return result
+}
+
+// entries returns the (key, value) tuples of a dict, in the order of their
+// keys.
+func entries(_ Caller, args []interface{}) interface{} {
+	checkArgs("entries", args, 1)
+	dict := dictArg("entries", args, 0)
+	result := Keys(dict)
+	for i, k := range result {
+		result[i] = Tuple{k, dict[k]}
+	}
+	return result
+}
+
+// contains reports whether a list has an element equal to v, a dict has the
+// key v, or a string contains the substring v.
+func contains(_ Caller, args []interface{}) interface{} {
+	checkArgs("contains", args, 2)
+	switch c := args[0].(type) {
+	case []interface{}:
+		for _, elem := range c {
+			if Equal(elem, args[1]) {
+				return true
+			}
+		}
+		return false
+	case map[interface{}]interface{}:
+		_, ok := c[CheckKey(args[1])]
+		return ok
+	case string:
+		sub, ok := args[1].(string)
+		if !ok {
+			panic(Errorf("contains expects a string to look for in a string, got %s", kindName(args[1])))
+		}
+		return strings.Contains(c, sub)
+	}
+	panic(Errorf("contains expects a list, dict or string, got %s", kindName(args[0])))
+}
+
+// intRange is the range builtin: range(end), range(start, end) or
+// range(start, end, step) returns the ints from start, which defaults to 0,
+// up to but not including end.
+func intRange(_ Caller, args []interface{}) interface{} {
+	checkArgRange("range", args, 1, 3)
+	start, end, step := 0, intArg("range", args, 0), 1
+	if len(args) > 1 {
+		start, end = end, intArg("range", args, 1)
+	}
+	if len(args) > 2 {
+		step = intArg("range", args, 2)
+	}
+	if step == 0 {
+		panic(Errorf("range step must not be 0"))
+	}
+	result := []interface{}{}
+	for i := start; (step > 0 && i < end) || (step < 0 && i > end); i += step {
+		result = append(result, i)
+	}
+	return result
+}
@@ -0,0 +1,179 @@
+package value
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Function is implemented by the closures of both engines, so that builtins
+// can describe them.
+type Function interface {
+	Signature() *Signature
+}
+
+// str converts any value to a string, the way print shows it.
+func str(_ Caller, args []interface{}) interface{} {
+	checkArgs("str", args, 1)
+	return Format(args[0])
+}
+
+// toInt is the int builtin. It truncates floats toward zero, turns bools
+// into 1 and 0, and parses strings, raising an error if they do not hold
+// an int.
+func toInt(_ Caller, args []interface{}) interface{} {
+	checkArgs("int", args, 1)
+	switch v := args[0].(type) {
+	case int:
+		return v
+	case float64:
+		if math.IsNaN(v) || v < math.MinInt64 || v >= math.MaxInt64 {
+			panic(Errorf("cannot convert %s to int", Format(v)))
+		}
+		return int(v)
+	case bool:
+		if v {
+			return 1
+		}
+		return 0
+	case string:
+		n, err := parseInt(v)
+		if err != nil {
+			panic(err)
+		}
+		return n
+	}
+	panic(Errorf("cannot convert %s to int", kindName(args[0])))
+}
+
+// toFloat is the float builtin. It widens ints, turns bools into 1.0 and
+// 0.0, and parses strings, raising an error if they do not hold a number.
+func toFloat(_ Caller, args []interface{}) interface{} {
+	checkArgs("float", args, 1)
+	switch v := args[0].(type) {
+	case float64:
+		return v
+	case int:
+		return float64(v)
+	case bool:
+		if v {
+			return 1.0
+		}
+		return 0.0
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			panic(Errorf("cannot parse %q as float", v))
+		}
+		return f
+	}
+	panic(Errorf("cannot convert %s to float", kindName(args[0])))
+}
+
+// parseIntBuiltin is the parseInt builtin. Unlike int it does not raise an
+// error on bad input but returns it, for the caller to test with typeof.
+func parseIntBuiltin(_ Caller, args []interface{}) interface{} {
+	checkArgs("parseInt", args, 1)
+	n, err := parseInt(stringArg("parseInt", args, 0))
+	if err != nil {
+		return err
+	}
+	return n
+}
+
+func parseInt(s string) (int, *Error) {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, Errorf("cannot parse %q as int", s)
+	}
+	return n, nil
+}
+
+// toBool is the bool builtin. Numbers are true unless they are 0, and
+// strings must be "true" or "false".
+func toBool(_ Caller, args []interface{}) interface{} {
+	checkArgs("bool", args, 1)
+	switch v := args[0].(type) {
+	case bool:
+		return v
+	case int:
+		return v != 0
+	case float64:
+		return v != 0
+	case string:
+		switch v {
+		case "true":
+			return true
+		case "false":
+			return false
+		}
+		panic(Errorf("cannot parse %q as bool", v))
+	}
+	panic(Errorf("cannot convert %s to bool", kindName(args[0])))
+}
+
+// typeOf is the typeof builtin: the name of the type of a value, written
+// the way the type checker writes types. Element types of lists and dicts
+// come from their contents and are unknown if they are empty or mixed;
+// parameter and return types of functions are not known at run time.
+func typeOf(_ Caller, args []interface{}) interface{} {
+	checkArgs("typeof", args, 1)
+	return typeName(args[0])
+}
+
+func typeName(v interface{}) string {
+	switch val := v.(type) {
+	case []interface{}:
+		return "[" + commonType(val) + "]"
+	case map[interface{}]interface{}:
+		keys, values := []interface{}{}, []interface{}{}
+		for k, v := range val {
+			keys = append(keys, k)
+			values = append(values, v)
+		}
+		return "{" + commonType(keys) + ": " + commonType(values) + "}"
+	case Tuple:
+		elems := make([]string, len(val))
+		for i, elem := range val {
+			elems[i] = typeName(elem)
+		}
+		return "(" + strings.Join(elems, ", ") + ")"
+	case *VariantDecl:
+		return functionType(val.Arity, false, val.Type)
+	case Function:
+		sig := val.Signature()
+		return functionType(len(sig.Params), sig.Variadic, "unknown")
+	}
+	name := kindName(v)
+	if name == "function" {
+		// A builtin, which takes any number of arguments
+		return functionType(1, true, "unknown")
+	}
+	return name
+}
+
+// commonType returns the type name shared by all the values, or unknown.
+func commonType(values []interface{}) string {
+	if len(values) == 0 {
+		return "unknown"
+	}
+	name := typeName(values[0])
+	for _, v := range values[1:] {
+		if typeName(v) != name {
+			return "unknown"
+		}
+	}
+	return name
+}
+
+// functionType names a function type whose parameter types are unknown.
+func functionType(params int, variadic bool, ret string) string {
+	names := make([]string, params)
+	for i := range names {
+		names[i] = "unknown"
+	}
+	if variadic {
+		names[params-1] = "...[unknown]"
+	}
+	return "fn(" + strings.Join(names, ", ") + ") -> " + ret
+}
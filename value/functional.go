@@ -0,0 +1,135 @@
+package value
+
+import "sort"
+
+// listArg returns argument i of a builtin, which must be a list.
+func listArg(name string, args []interface{}, i int) []interface{} {
+	list, ok := args[i].([]interface{})
+	if !ok {
+		panic(Errorf("%s expects a list for argument %d, got %s", name, i+1, kindName(args[i])))
+	}
+	return list
+}
+
+// test calls a predicate, which must return a bool.
+func test(name string, call Caller, pred, elem interface{}) bool {
+	result, ok := call(pred, elem).(bool)
+	if !ok {
+		panic(Errorf("%s expects a function that returns bool", name))
+	}
+	return result
+}
+
+// mapList is the map builtin: the results of calling f on each element.
+func mapList(call Caller, args []interface{}) interface{} {
+	checkArgs("map", args, 2)
+	list := listArg("map", args, 0)
+	result := make([]interface{}, len(list))
+	for i, elem := range list {
+		result[i] = call(args[1], elem)
+	}
+	return result
+}
+
+// filter returns the elements for which the predicate is true.
+func filter(call Caller, args []interface{}) interface{} {
+	checkArgs("filter", args, 2)
+	result := []interface{}{}
+	for _, elem := range listArg("filter", args, 0) {
+		if test("filter", call, args[1], elem) {
+			result = append(result, elem)
+		}
+	}
+	return result
+}
+
+// reduce folds a list into one value: reduce(xs, init, f) calls
+// f(acc, x) for each element, starting with init as acc.
+func reduce(call Caller, args []interface{}) interface{} {
+	checkArgs("reduce", args, 3)
+	acc := args[1]
+	for _, elem := range listArg("reduce", args, 0) {
+		acc = call(args[2], acc, elem)
+	}
+	return acc
+}
+
+// anyOf reports whether the predicate is true for some element. It stops at
+// the first one.
+func anyOf(call Caller, args []interface{}) interface{} {
+	checkArgs("any", args, 2)
+	for _, elem := range listArg("any", args, 0) {
+		if test("any", call, args[1], elem) {
+			return true
+		}
+	}
+	return false
+}
+
+// allOf reports whether the predicate is true for every element. It stops
+// at the first one for which it is false.
+func allOf(call Caller, args []interface{}) interface{} {
+	checkArgs("all", args, 2)
+	for _, elem := range listArg("all", args, 0) {
+		if !test("all", call, args[1], elem) {
+			return false
+		}
+	}
+	return true
+}
+
+// find returns the first element for which the predicate is true, and
+// raises an error if there is none.
+func find(call Caller, args []interface{}) interface{} {
+	checkArgs("find", args, 2)
+	for _, elem := range listArg("find", args, 0) {
+		if test("find", call, args[1], elem) {
+			return elem
+		}
+	}
+	panic(Errorf("find: no element matches"))
+}
+
+// sortList returns a sorted copy of a list. Without a comparator elements
+// are compared the way < compares them; a comparator cmp(a, b) returns a
+// negative int if a comes first, a positive int if b does, and 0 if they are
+// equal. The sort is stable.
+func sortList(call Caller, args []interface{}) interface{} {
+	checkArgRange("sort", args, 1, 2)
+	result := append([]interface{}{}, listArg("sort", args, 0)...)
+	less := func(i, j int) bool { return Compare(result[i], result[j]) < 0 }
+	if len(args) == 2 {
+		less = func(i, j int) bool {
+			order, ok := call(args[1], result[i], result[j]).(int)
+			if !ok {
+				panic(Errorf("sort expects a comparator that returns int"))
+			}
+			return order < 0
+		}
+	}
+	sort.SliceStable(result, less)
+	return result
+}
+
+// zip pairs up the elements of two lists into tuples, stopping at the end
+// of the shorter one.
+func zip(_ Caller, args []interface{}) interface{} {
+	checkArgs("zip", args, 2)
+	xs, ys := listArg("zip", args, 0), listArg("zip", args, 1)
+	result := make([]interface{}, min(len(xs), len(ys)))
+	for i := range result {
+		result[i] = Tuple{xs[i], ys[i]}
+	}
+	return result
+}
+
+// enumerate pairs each element with its index, as (index, element) tuples.
+func enumerate(_ Caller, args []interface{}) interface{} {
+	checkArgs("enumerate", args, 1)
+	list := listArg("enumerate", args, 0)
+	result := make([]interface{}, len(list))
+	for i, elem := range list {
+		result[i] = Tuple{i, elem}
+	}
+	return result
+}
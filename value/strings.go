@@ -0,0 +1,251 @@
+package value
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// split is the split builtin: the parts of s between each sep. An empty sep
+// splits s into characters.
+func split(_ Caller, args []interface{}) interface{} {
+	checkArgs("split", args, 2)
+	parts := strings.Split(stringArg("split", args, 0), stringArg("split", args, 1))
+	return stringList(parts)
+}
+
+// join concatenates a list of strings with sep between them.
+func join(_ Caller, args []interface{}) interface{} {
+	checkArgs("join", args, 2)
+	list := listArg("join", args, 0)
+	parts := make([]string, len(list))
+	for i, elem := range list {
+		s, ok := elem.(string)
+		if !ok {
+			panic(Errorf("join expects a list of strings, got an element of type %s", kindName(elem)))
+		}
+		parts[i] = s
+	}
+	return strings.Join(parts, stringArg("join", args, 1))
+}
+
+// trim removes leading and trailing white space.
+func trim(_ Caller, args []interface{}) interface{} {
+	checkArgs("trim", args, 1)
+	return strings.TrimSpace(stringArg("trim", args, 0))
+}
+
+func upper(_ Caller, args []interface{}) interface{} {
+	checkArgs("upper", args, 1)
+	return strings.ToUpper(stringArg("upper", args, 0))
+}
+
+func lower(_ Caller, args []interface{}) interface{} {
+	checkArgs("lower", args, 1)
+	return strings.ToLower(stringArg("lower", args, 0))
+}
+
+// replace replaces every occurrence of old in s with new.
+func replace(_ Caller, args []interface{}) interface{} {
+	checkArgs("replace", args, 3)
+	return strings.ReplaceAll(stringArg("replace", args, 0), stringArg("replace", args, 1), stringArg("replace", args, 2))
+}
+
+func startsWith(_ Caller, args []interface{}) interface{} {
+	checkArgs("startsWith", args, 2)
+	return strings.HasPrefix(stringArg("startsWith", args, 0), stringArg("startsWith", args, 1))
+}
+
+func endsWith(_ Caller, args []interface{}) interface{} {
+	checkArgs("endsWith", args, 2)
+	return strings.HasSuffix(stringArg("endsWith", args, 0), stringArg("endsWith", args, 1))
+}
+
+// indexOf returns the position of the first occurrence of sub in s, counted
+// in characters like len and substring, or -1 if there is none.
+func indexOf(_ Caller, args []interface{}) interface{} {
+	checkArgs("indexOf", args, 2)
+	s := stringArg("indexOf", args, 0)
+	i := strings.Index(s, stringArg("indexOf", args, 1))
+	if i < 0 {
+		return -1
+	}
+	return utf8.RuneCountInString(s[:i])
+}
+
+// substring returns the characters of s from start up to but not including
+// end, which defaults to the length.
+func substring(_ Caller, args []interface{}) interface{} {
+	checkArgRange("substring", args, 2, 3)
+	chars := []rune(stringArg("substring", args, 0))
+	start, end := intArg("substring", args, 1), len(chars)
+	if len(args) == 3 {
+		end = intArg("substring", args, 2)
+	}
+	if start < 0 || end > len(chars) || start > end {
+		panic(Errorf("substring bounds %d..%d out of range for length %d", start, end, len(chars)))
+	}
+	return string(chars[start:end])
+}
+
+// repeat returns n copies of s.
+func repeat(_ Caller, args []interface{}) interface{} {
+	checkArgs("repeat", args, 2)
+	n := intArg("repeat", args, 1)
+	if n < 0 {
+		panic(Errorf("repeat count must not be negative, got %d", n))
+	}
+	return strings.Repeat(stringArg("repeat", args, 0), n)
+}
+
+func padLeft(_ Caller, args []interface{}) interface{} {
+	s, padding := pad("padLeft", args)
+	return padding + s
+}
+
+func padRight(_ Caller, args []interface{}) interface{} {
+	s, padding := pad("padRight", args)
+	return s + padding
+}
+
+// pad checks the arguments of padLeft and padRight, (s, width) and an
+// optional pad character that defaults to a space, and returns s with the
+// padding that brings it up to width characters.
+func pad(name string, args []interface{}) (string, string) {
+	checkArgRange(name, args, 2, 3)
+	s, width := stringArg(name, args, 0), intArg(name, args, 1)
+	fill := " "
+	if len(args) == 3 {
+		fill = stringArg(name, args, 2)
+		if utf8.RuneCountInString(fill) != 1 {
+			panic(Errorf("%s expects a single character to pad with, got %q", name, fill))
+		}
+	}
+	n := width - utf8.RuneCountInString(s)
+	if n <= 0 {
+		return s, ""
+	}
+	return s, strings.Repeat(fill, n)
+}
+
+// chars returns the characters of s as a list of one-character strings.
+func chars(_ Caller, args []interface{}) interface{} {
+	checkArgs("chars", args, 1)
+	return stringList(strings.Split(stringArg("chars", args, 0), ""))
+}
+
+// format replaces each {} in a template with the next argument, shown the
+// way print shows it. {{ and }} stand for literal braces.
+func format(_ Caller, args []interface{}) interface{} {
+	if len(args) == 0 {
+		panic(Errorf("format expects at least 1 argument, got 0"))
+	}
+	template := stringArg("format", args, 0)
+	values := args[1:]
+	var sb strings.Builder
+	used := 0
+	for i := 0; i < len(template); i++ {
+		switch {
+		case strings.HasPrefix(template[i:], "{{"):
+			sb.WriteByte('{')
+			i++
+		case strings.HasPrefix(template[i:], "}}"):
+			sb.WriteByte('}')
+			i++
+		case strings.HasPrefix(template[i:], "{}"):
+			if used < len(values) {
+				sb.WriteString(Format(values[used]))
+			}
+			used++
+			i++
+		default:
+			sb.WriteByte(template[i])
+		}
+	}
+	if used != len(values) {
+		panic(Errorf("format template needs %d arguments, got %d", used, len(values)))
+	}
+	return sb.String()
+}
+
+// sprintf formats its arguments according to printf-style verbs: %d for
+// ints, %f, %e and %g for numbers, %x for ints and strings, %s and %v for
+// any value shown the way print shows it, %q for quoted strings, and %% for
+// a percent sign. Flags, width and precision work as in Go.
+func sprintf(_ Caller, args []interface{}) interface{} {
+	if len(args) == 0 {
+		panic(Errorf("sprintf expects at least 1 argument, got 0"))
+	}
+	layout := stringArg("sprintf", args, 0)
+	values := args[1:]
+	var sb strings.Builder
+	used := 0
+	for i := 0; i < len(layout); i++ {
+		if layout[i] != '%' {
+			sb.WriteByte(layout[i])
+			continue
+		}
+		// The verb is the first letter after the flags, width and precision
+		end := i + 1
+		for end < len(layout) && strings.IndexByte("+-# 0123456789.", layout[end]) >= 0 {
+			end++
+		}
+		if end == len(layout) {
+			panic(Errorf("sprintf format ends in an incomplete verb %s", layout[i:]))
+		}
+		spec, verb := layout[i:end+1], layout[end]
+		i = end
+		if verb == '%' {
+			sb.WriteByte('%')
+			continue
+		}
+		if used < len(values) {
+			sb.WriteString(formatVerb(spec, verb, values[used]))
+		}
+		used++
+	}
+	if used != len(values) {
+		panic(Errorf("sprintf format needs %d arguments, got %d", used, len(values)))
+	}
+	return sb.String()
+}
+
+// formatVerb formats one argument of sprintf.
+func formatVerb(spec string, verb byte, v interface{}) string {
+	switch verb {
+	case 'd':
+		if _, ok := v.(int); ok {
+			return fmt.Sprintf(spec, v)
+		}
+	case 'f', 'e', 'g':
+		switch n := v.(type) {
+		case float64:
+			return fmt.Sprintf(spec, n)
+		case int:
+			return fmt.Sprintf(spec, float64(n))
+		}
+	case 'x', 'X':
+		switch v.(type) {
+		case int, string:
+			return fmt.Sprintf(spec, v)
+		}
+	case 'q':
+		if _, ok := v.(string); ok {
+			return fmt.Sprintf(spec, v)
+		}
+	case 's', 'v':
+		return fmt.Sprintf(spec[:len(spec)-1]+"s", Format(v))
+	default:
+		panic(Errorf("sprintf format has unknown verb %s", spec))
+	}
+	panic(Errorf("sprintf verb %s cannot format %s", spec, kindName(v)))
+}
+
+// stringList converts strings to a Flux list.
+func stringList(strs []string) []interface{} {
+	result := make([]interface{}, len(strs))
+	for i, s := range strs {
+		result[i] = s
+	}
+	return result
+}
@@ -0,0 +1,604 @@
+// Package value holds the pieces of the Flux runtime value model that are
+// shared by the tree-walking runtime and the bytecode VM.
+package value
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Error is a Flux runtime error. Both engines raise it with panic and
+// unwind to the innermost try expression, or to the top of Run, so a failing
+// program reports a message instead of crashing with a Go stack trace.
+// Errors are also values: catch binds the error it caught, and error(msg)
+// makes one without raising it.
+type Error struct {
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Errorf builds a runtime error with a formatted message.
+func Errorf(format string, args ...interface{}) *Error {
+	return &Error{Message: fmt.Sprintf(format, args...)}
+}
+
+// RecordDecl describes a record type: its name and its fields in declaration
+// order.
+type RecordDecl struct {
+	Name   string
+	Fields []string
+}
+
+// Record is an instance of a record type. Like lists and dicts, records are
+// mutable and shared by reference.
+type Record struct {
+	Decl   *RecordDecl
+	Values []interface{}
+}
+
+// NewRecord builds a record of the given type from field names and values in
+// any order. Every declared field must be given exactly once.
+func NewRecord(decl *RecordDecl, names []string, values []interface{}) *Record {
+	rec := &Record{Decl: decl, Values: make([]interface{}, len(decl.Fields))}
+	set := make([]bool, len(decl.Fields))
+	for i, name := range names {
+		idx := decl.fieldIndex(name)
+		if idx < 0 {
+			panic(Errorf("%s has no field %s", decl.Name, name))
+		}
+		if set[idx] {
+			panic(Errorf("field %s given twice in %s literal", name, decl.Name))
+		}
+		rec.Values[idx] = values[i]
+		set[idx] = true
+	}
+	for i, ok := range set {
+		if !ok {
+			panic(Errorf("missing field %s in %s literal", decl.Fields[i], decl.Name))
+		}
+	}
+	return rec
+}
+
+func (d *RecordDecl) fieldIndex(name string) int {
+	for i, field := range d.Fields {
+		if field == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// GetField returns the named field of a record.
+func GetField(v interface{}, name string) interface{} {
+	if e, ok := v.(*Error); ok && name == "message" {
+		return e.Message
+	}
+	rec, ok := v.(*Record)
+	if !ok {
+		panic(Errorf("cannot access field %s of %s", name, kindName(v)))
+	}
+	idx := rec.Decl.fieldIndex(name)
+	if idx < 0 {
+		panic(Errorf("%s has no field %s", rec.Decl.Name, name))
+	}
+	return rec.Values[idx]
+}
+
+// SetField stores v in the named field of a record, in place.
+func SetField(target interface{}, name string, v interface{}) {
+	rec, ok := target.(*Record)
+	if !ok {
+		panic(Errorf("cannot assign to field %s of %s", name, kindName(target)))
+	}
+	idx := rec.Decl.fieldIndex(name)
+	if idx < 0 {
+		panic(Errorf("%s has no field %s", rec.Decl.Name, name))
+	}
+	rec.Values[idx] = v
+}
+
+// Signature describes the parameters of a function: their names, which of
+// them have default values, and whether the last one is variadic.
+type Signature struct {
+	Params     []string
+	HasDefault []bool
+	Variadic   bool
+}
+
+// Bind matches the arguments of a call to parameters. names holds the
+// parameter name of each argument, or "" for a positional one, and may be
+// nil if all are positional. Bind returns the value of each parameter and
+// whether it was given; a parameter that was not given has a default value.
+// A variadic parameter collects the remaining positional arguments into a
+// list.
+func (s *Signature) Bind(args []interface{}, names []string) ([]interface{}, []bool) {
+	values := make([]interface{}, len(s.Params))
+	given := make([]bool, len(s.Params))
+	fixed := len(s.Params)
+	if s.Variadic {
+		fixed--
+		values[fixed] = []interface{}{}
+	}
+
+	named := false
+	for i, arg := range args {
+		if names != nil && names[i] != "" {
+			named = true
+			idx := s.index(names[i])
+			if idx < 0 {
+				panic(Errorf("no parameter named %s", names[i]))
+			}
+			if given[idx] {
+				panic(Errorf("parameter %s given twice", names[i]))
+			}
+			values[idx], given[idx] = arg, true
+			continue
+		}
+		switch {
+		case named:
+			panic(Errorf("positional argument after named argument"))
+		case i < fixed:
+			values[i], given[i] = arg, true
+		case s.Variadic:
+			values[fixed] = append(values[fixed].([]interface{}), arg)
+			given[fixed] = true
+		case s.hasDefaults():
+			panic(Errorf("expected at most %d arguments, got %d", len(s.Params), len(args)))
+		default:
+			panic(Errorf("expected %d arguments, got %d", len(s.Params), len(args)))
+		}
+	}
+
+	for i := 0; i < fixed; i++ {
+		if !given[i] && !s.HasDefault[i] {
+			panic(Errorf("missing argument for parameter %s", s.Params[i]))
+		}
+	}
+	if s.Variadic {
+		given[fixed] = true
+	}
+	return values, given
+}
+
+// PositionalOnly rejects named arguments, for functions whose parameters
+// have no names, such as builtins and constructors.
+func PositionalOnly(names []string) {
+	for _, name := range names {
+		if name != "" {
+			panic(Errorf("no parameter named %s", name))
+		}
+	}
+}
+
+func (s *Signature) index(name string) int {
+	for i, param := range s.Params {
+		if param == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func (s *Signature) hasDefaults() bool {
+	for _, d := range s.HasDefault {
+		if d {
+			return true
+		}
+	}
+	return false
+}
+
+// Tuple is a fixed-size sequence of values, such as (q, r). Unlike lists,
+// tuples cannot be changed.
+type Tuple []interface{}
+
+// VariantDecl is a constructor of a sum type, such as Circle in
+// type Shape = Circle(int) | Rect(int, int). A constructor that takes
+// arguments is itself a function value.
+type VariantDecl struct {
+	Type  string
+	Name  string
+	Arity int
+}
+
+func (d *VariantDecl) String() string {
+	return "<fn>"
+}
+
+// Builds reports whether v was made by this constructor.
+func (d *VariantDecl) Builds(v interface{}) bool {
+	variant, ok := v.(*Variant)
+	return ok && variant.Decl.Type == d.Type && variant.Decl.Name == d.Name
+}
+
+// Variant is a value of a sum type: the constructor that made it and the
+// arguments it was given. Variants are immutable.
+type Variant struct {
+	Decl   *VariantDecl
+	Values []interface{}
+}
+
+// NewVariant applies a constructor to its arguments.
+func NewVariant(decl *VariantDecl, args []interface{}) *Variant {
+	if len(args) != decl.Arity {
+		panic(Errorf("%s expects %d arguments, got %d", decl.Name, decl.Arity, len(args)))
+	}
+	return &Variant{Decl: decl, Values: append([]interface{}{}, args...)}
+}
+
+// Equal reports whether two values are equal. Lists, tuples, dicts,
+// records and variants are compared element by element; everything else
+// uses Go equality.
+func Equal(a, b interface{}) bool {
+	switch av := a.(type) {
+	case []interface{}:
+		bv, ok := b.([]interface{})
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for i := range av {
+			if !Equal(av[i], bv[i]) {
+				return false
+			}
+		}
+		return true
+	case Tuple:
+		bv, ok := b.(Tuple)
+		return ok && Equal([]interface{}(av), []interface{}(bv))
+	case map[interface{}]interface{}:
+		bv, ok := b.(map[interface{}]interface{})
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for k, v := range av {
+			other, exists := bv[k]
+			if !exists || !Equal(v, other) {
+				return false
+			}
+		}
+		return true
+	case *Record:
+		bv, ok := b.(*Record)
+		if !ok || av.Decl.Name != bv.Decl.Name || len(av.Values) != len(bv.Values) {
+			return false
+		}
+		for i := range av.Values {
+			if !Equal(av.Values[i], bv.Values[i]) {
+				return false
+			}
+		}
+		return true
+	case *Variant:
+		if !av.Decl.Builds(b) {
+			return false
+		}
+		return Equal(av.Values, b.(*Variant).Values)
+	case *Error:
+		bv, ok := b.(*Error)
+		return ok && av.Message == bv.Message
+	case int:
+		if bv, ok := b.(float64); ok {
+			return float64(av) == bv
+		}
+		return a == b
+	case float64:
+		if bv, ok := b.(int); ok {
+			return av == float64(bv)
+		}
+		return a == b
+	default:
+		return a == b
+	}
+}
+
+// Add adds two numbers or concatenates two strings.
+func Add(a, b interface{}) interface{} {
+	if as, ok := a.(string); ok {
+		if bs, ok := b.(string); ok {
+			return as + bs
+		}
+	}
+	return arithmetic("+", a, b,
+		func(x, y int) int { return x + y },
+		func(x, y float64) float64 { return x + y })
+}
+
+func Sub(a, b interface{}) interface{} {
+	return arithmetic("-", a, b,
+		func(x, y int) int { return x - y },
+		func(x, y float64) float64 { return x - y })
+}
+
+func Mul(a, b interface{}) interface{} {
+	return arithmetic("*", a, b,
+		func(x, y int) int { return x * y },
+		func(x, y float64) float64 { return x * y })
+}
+
+func Div(a, b interface{}) interface{} {
+	if isZero(b) {
+		panic(Errorf("division by zero"))
+	}
+	return arithmetic("/", a, b,
+		func(x, y int) int { return x / y },
+		func(x, y float64) float64 { return x / y })
+}
+
+func Mod(a, b interface{}) interface{} {
+	if isZero(b) {
+		panic(Errorf("modulo by zero"))
+	}
+	return arithmetic("%", a, b,
+		func(x, y int) int { return x % y },
+		math.Mod)
+}
+
+// Negate negates a number.
+func Negate(v interface{}) interface{} {
+	switch n := v.(type) {
+	case int:
+		return -n
+	case float64:
+		return -n
+	}
+	panic(Errorf("invalid operand for -: %s", kindName(v)))
+}
+
+// arithmetic applies a numeric operator. Two ints give an int; if either
+// operand is a float the other is widened and the result is a float.
+func arithmetic(op string, a, b interface{}, intOp func(x, y int) int, floatOp func(x, y float64) float64) interface{} {
+	switch av := a.(type) {
+	case int:
+		switch bv := b.(type) {
+		case int:
+			return intOp(av, bv)
+		case float64:
+			return floatOp(float64(av), bv)
+		}
+	case float64:
+		switch bv := b.(type) {
+		case int:
+			return floatOp(av, float64(bv))
+		case float64:
+			return floatOp(av, bv)
+		}
+	}
+	panic(Errorf("invalid operands for %s: %s and %s", op, kindName(a), kindName(b)))
+}
+
+func isZero(v interface{}) bool {
+	switch n := v.(type) {
+	case int:
+		return n == 0
+	case float64:
+		return n == 0
+	}
+	return false
+}
+
+// Compare orders two numbers numerically or two strings lexicographically,
+// returning -1, 0 or +1. Any other combination is a runtime error.
+func Compare(a, b interface{}) int {
+	switch av := a.(type) {
+	case int:
+		switch bv := b.(type) {
+		case int:
+			return cmp.Compare(av, bv)
+		case float64:
+			return cmp.Compare(float64(av), bv)
+		}
+	case float64:
+		switch bv := b.(type) {
+		case int:
+			return cmp.Compare(av, float64(bv))
+		case float64:
+			return cmp.Compare(av, bv)
+		}
+	case string:
+		if bv, ok := b.(string); ok {
+			return strings.Compare(av, bv)
+		}
+	}
+	panic(Errorf("cannot compare %s and %s", kindName(a), kindName(b)))
+}
+
+// Index returns the element at index in a list or the value under a key in
+// a dict.
+func Index(container, index interface{}) interface{} {
+	switch c := container.(type) {
+	case []interface{}:
+		i, ok := index.(int)
+		if !ok {
+			panic(Errorf("list index must be an int, got %s", kindName(index)))
+		}
+		if i < 0 || i >= len(c) {
+			panic(Errorf("list index %d out of range for length %d", i, len(c)))
+		}
+		return c[i]
+	case map[interface{}]interface{}:
+		v, ok := c[CheckKey(index)]
+		if !ok {
+			panic(Errorf("key not found: %s", formatNested(index)))
+		}
+		return v
+	default:
+		panic(Errorf("cannot index into %s", kindName(container)))
+	}
+}
+
+// CheckKey returns key if it can be used as a dict key. Lists, tuples,
+// dicts and builtin functions cannot, since Go cannot hash them.
+func CheckKey(key interface{}) interface{} {
+	if t := reflect.TypeOf(key); t != nil && !t.Comparable() {
+		panic(Errorf("%s cannot be used as a dict key", kindName(key)))
+	}
+	return key
+}
+
+// SetIndex stores v at index in a list or under a key in a dict, in place.
+// Dict keys are added if missing; list indexes must already exist.
+func SetIndex(container, index, v interface{}) {
+	switch c := container.(type) {
+	case []interface{}:
+		i, ok := index.(int)
+		if !ok {
+			panic(Errorf("list index must be an int, got %s", kindName(index)))
+		}
+		if i < 0 || i >= len(c) {
+			panic(Errorf("list index %d out of range for length %d", i, len(c)))
+		}
+		c[i] = v
+	case map[interface{}]interface{}:
+		c[CheckKey(index)] = v
+	default:
+		panic(Errorf("cannot assign to an index of %s", kindName(container)))
+	}
+}
+
+// Iterate returns the elements a for loop visits: the elements of a list, or
+// the keys of a dict in sorted order.
+func Iterate(v interface{}) []interface{} {
+	switch c := v.(type) {
+	case []interface{}:
+		return c
+	case map[interface{}]interface{}:
+		return Keys(c)
+	default:
+		panic(Errorf("cannot iterate over %s", kindName(v)))
+	}
+}
+
+// Keys returns the keys of a dict, sorted so that iteration order is
+// deterministic. Keys of different kinds are grouped by kind.
+func Keys(dict map[interface{}]interface{}) []interface{} {
+	keys := make([]interface{}, 0, len(dict))
+	for k := range dict {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if ka, kb := kindName(a), kindName(b); ka != kb {
+			return ka < kb
+		}
+		switch a.(type) {
+		case int, float64, string:
+			return Compare(a, b) < 0
+		}
+		return formatNested(a) < formatNested(b)
+	})
+	return keys
+}
+
+// RangeBounds checks that the bounds of a range start..end are ints.
+func RangeBounds(start, end interface{}) (int, int) {
+	s, ok1 := start.(int)
+	e, ok2 := end.(int)
+	if !ok1 || !ok2 {
+		panic(Errorf("range bounds must be int, got %s and %s", kindName(start), kindName(end)))
+	}
+	return s, e
+}
+
+// kindName names the kind of a value for error messages.
+func kindName(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "void"
+	case int:
+		return "int"
+	case float64:
+		return "float"
+	case string:
+		return "string"
+	case bool:
+		return "bool"
+	case []interface{}:
+		return "list"
+	case Tuple:
+		return "tuple"
+	case map[interface{}]interface{}:
+		return "dict"
+	case *Record:
+		return v.(*Record).Decl.Name
+	case *Variant:
+		return v.(*Variant).Decl.Type
+	case *Error:
+		return "error"
+	default:
+		return "function"
+	}
+}
+
+// Format renders a value the way Flux prints it and interpolates it into
+// strings. Strings nested inside lists and dicts are quoted; dict entries are
+// sorted so the output is deterministic.
+func Format(v interface{}) string {
+	switch val := v.(type) {
+	case string:
+		return val
+	default:
+		return formatNested(v)
+	}
+}
+
+func formatNested(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return "void"
+	case string:
+		return strconv.Quote(val)
+	case float64:
+		s := strconv.FormatFloat(val, 'g', -1, 64)
+		if !strings.ContainsAny(s, ".eIN") {
+			s += ".0"
+		}
+		return s
+	case []interface{}:
+		elems := make([]string, len(val))
+		for i, elem := range val {
+			elems[i] = formatNested(elem)
+		}
+		return "[" + strings.Join(elems, ", ") + "]"
+	case Tuple:
+		elems := make([]string, len(val))
+		for i, elem := range val {
+			elems[i] = formatNested(elem)
+		}
+		return "(" + strings.Join(elems, ", ") + ")"
+	case map[interface{}]interface{}:
+		pairs := make([]string, 0, len(val))
+		for k, elem := range val {
+			pairs = append(pairs, formatNested(k)+": "+formatNested(elem))
+		}
+		sort.Strings(pairs)
+		return "{" + strings.Join(pairs, ", ") + "}"
+	case *Record:
+		fields := make([]string, len(val.Values))
+		for i, elem := range val.Values {
+			fields[i] = val.Decl.Fields[i] + ": " + formatNested(elem)
+		}
+		return val.Decl.Name + " {" + strings.Join(fields, ", ") + "}"
+	case *Variant:
+		if len(val.Values) == 0 {
+			return val.Decl.Name
+		}
+		args := make([]string, len(val.Values))
+		for i, elem := range val.Values {
+			args[i] = formatNested(elem)
+		}
+		return val.Decl.Name + "(" + strings.Join(args, ", ") + ")"
+	case *Error:
+		return "error(" + strconv.Quote(val.Message) + ")"
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,103 @@
+package vm
+
+import "github.com/pranavms13/flux-lang/value"
+
+type PatternKind byte
+
+const (
+	PatWildcard PatternKind = iota
+	PatLiteral
+	PatBind
+	PatList
+	PatDict
+	PatVariant
+	PatTuple
+)
+
+// Pattern is a compiled match pattern. Bindings have already been resolved
+// to local slots of the frame running the match.
+type Pattern struct {
+	Kind    PatternKind
+	Literal interface{}
+	// Local slot for PatBind
+	Slot int
+	// Element patterns for PatList and PatTuple, value patterns for PatDict,
+	// argument patterns for PatVariant
+	Elems []*Pattern
+	// Keys for PatDict, parallel to Elems
+	Keys []interface{}
+	// For PatList: whether a ..rest pattern follows the elements, and the
+	// slot it binds, or -1 if it is unnamed
+	HasRest  bool
+	RestSlot int
+	// Constructor for PatVariant
+	Ctor *value.VariantDecl
+}
+
+// match reports whether v matches the pattern, storing bindings in locals.
+func (p *Pattern) match(v interface{}, locals []interface{}) bool {
+	switch p.Kind {
+	case PatWildcard:
+		return true
+	case PatLiteral:
+		return value.Equal(p.Literal, v)
+	case PatBind:
+		locals[p.Slot] = v
+		return true
+	case PatList:
+		list, ok := v.([]interface{})
+		if !ok {
+			return false
+		}
+		if len(list) < len(p.Elems) || (!p.HasRest && len(list) != len(p.Elems)) {
+			return false
+		}
+		for i, elem := range p.Elems {
+			if !elem.match(list[i], locals) {
+				return false
+			}
+		}
+		if p.HasRest && p.RestSlot >= 0 {
+			locals[p.RestSlot] = append([]interface{}{}, list[len(p.Elems):]...)
+		}
+		return true
+	case PatDict:
+		dict, ok := v.(map[interface{}]interface{})
+		if !ok {
+			return false
+		}
+		for i, key := range p.Keys {
+			elem, exists := dict[key]
+			if !exists || !p.Elems[i].match(elem, locals) {
+				return false
+			}
+		}
+		return true
+	case PatTuple:
+		tuple, ok := v.(value.Tuple)
+		if !ok || len(tuple) != len(p.Elems) {
+			return false
+		}
+		for i, elem := range p.Elems {
+			if !elem.match(tuple[i], locals) {
+				return false
+			}
+		}
+		return true
+	case PatVariant:
+		if !p.Ctor.Builds(v) {
+			return false
+		}
+		args := v.(*value.Variant).Values
+		if len(args) != len(p.Elems) {
+			return false
+		}
+		for i, elem := range p.Elems {
+			if !elem.match(args[i], locals) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
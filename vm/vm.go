@@ -2,6 +2,11 @@ package vm
 
 import (
 	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/pranavms13/flux-lang/value"
 )
 
 type Opcode byte
@@ -10,9 +15,15 @@ const (
 	OpConstant Opcode = iota
 	OpAdd
 	OpSub
+	OpMul
+	OpDiv
+	OpMod
 	OpEqual
+	OpNotEqual
 	OpGreater
+	OpGreaterEqual
 	OpLess
+	OpLessEqual
 	OpPop
 	OpPrint
 	OpReturn
@@ -26,73 +37,305 @@ const (
 	OpIndex
 	OpArray
 	OpDict
+	OpGetLocal
+	OpGetUpvalue
+	OpNot
+	OpConcat
+	OpSetLocal
+	OpCloseUpvalues
+	OpNil
+	OpSetGlobal
+	OpSetUpvalue
+	OpSetIndex
+	OpLoop
+	OpIter
+	OpRange
+	OpForNext
+	OpMatch
+	OpNoMatch
+	OpRecord
+	OpGetField
+	OpSetField
+	OpTuple
+	OpDestructure
+	OpNegate
+	OpCallNamed
+	OpDefault
+	OpTry
+	OpEndTry
 )
 
 type Chunk struct {
 	Code      []byte
 	Constants []interface{}
-	Params    []string
+	// Parameters of a function; nil for the script
+	Signature *value.Signature
+	Upvalues  []UpvalueRef
+	// Number of local variable slots, including the parameters
+	NumLocals int
+}
+
+// UpvalueRef tells OpClosure where to find a captured variable: either a
+// local slot of the enclosing function (IsLocal) or one of the enclosing
+// closure's own upvalues.
+type UpvalueRef struct {
+	IsLocal bool
+	Index   int
 }
 
 type Closure struct {
-	Chunk *Chunk
-	Args  []interface{}
+	Chunk    *Chunk
+	Upvalues []*Upvalue
 }
 
-type VM struct {
-	chunk   *Chunk
+func (c *Closure) String() string {
+	return "<fn>"
+}
+
+func (c *Closure) Signature() *value.Signature {
+	return c.Chunk.Signature
+}
+
+// Upvalue is a variable captured by a closure. While the variable's scope is
+// active the upvalue points at its local slot; when the scope ends the value
+// is moved into the upvalue itself so the slot can be reused.
+type Upvalue struct {
+	location *interface{}
+	closed   interface{}
+}
+
+// iterator is the hidden state of a for loop: either the elements to visit
+// or the remaining part of an integer range.
+type iterator struct {
+	items   []interface{}
+	isRange bool
+	next    int
+	end     int
+}
+
+// advance returns the next element, or false when the loop is done.
+func (it *iterator) advance() (interface{}, bool) {
+	if it.isRange {
+		if it.next >= it.end {
+			return nil, false
+		}
+		it.next++
+		return it.next - 1, true
+	}
+	if it.next >= len(it.items) {
+		return nil, false
+	}
+	it.next++
+	return it.items[it.next-1], true
+}
+
+// missingArg fills the slot of a parameter that a call did not give, until
+// the function's prologue stores its default value.
+type missingArg struct{}
+
+type CallFrame struct {
+	closure *Closure
 	ip      int
-	stack   []interface{}
-	globals map[string]interface{}
-	locals  map[string]interface{}
+	// Stack height when the frame was entered
+	base   int
+	locals []interface{}
+	// Upvalues still pointing into locals, by slot
+	openUpvalues map[int]*Upvalue
+}
+
+// handler is the catch block of a try expression that is running. A runtime
+// error unwinds the frames and the stack to where they were when the try
+// was entered, then jumps to the catch block with the error on the stack.
+type handler struct {
+	frame int
+	stack int
+	// First local slot declared inside the try, whose upvalues must be
+	// closed because the catch block reuses the slots
+	firstLocal int
+	ip         int
+}
+
+type VM struct {
+	frames   []*CallFrame
+	stack    []interface{}
+	globals  map[string]interface{}
+	handlers []handler
+	// Where print, println and echoed values are written
+	out io.Writer
+	// Builtin functions, which globals of the same name shadow
+	builtins map[string]value.Builtin
 }
 
+// New returns a VM that runs chunk, writing its output to standard output.
 func New(chunk *Chunk) *VM {
+	return NewWithOutput(chunk, os.Stdout)
+}
+
+// NewWithOutput returns a VM that runs chunk, writing its output to out.
+func NewWithOutput(chunk *Chunk, out io.Writer) *VM {
+	script := &Closure{Chunk: chunk}
+	builtins := map[string]value.Builtin{
+		"print": func(_ value.Caller, args []interface{}) interface{} {
+			value.Print(out, args, false)
+			return nil
+		},
+		"println": func(_ value.Caller, args []interface{}) interface{} {
+			value.Print(out, args, true)
+			return nil
+		},
+	}
+	for name, builtin := range value.Builtins {
+		builtins[name] = builtin
+	}
 	return &VM{
-		chunk:   chunk,
-		ip:      0,
-		stack:   []interface{}{},
-		globals: map[string]interface{}{},
-		locals:  map[string]interface{}{},
+		frames:   []*CallFrame{newFrame(script, 0)},
+		stack:    []interface{}{},
+		globals:  map[string]interface{}{},
+		out:      out,
+		builtins: builtins,
 	}
 }
 
-func (vm *VM) Run() {
-	for vm.ip < len(vm.chunk.Code) {
+// Run executes the chunk. A Flux runtime error unwinds to the innermost
+// running try expression; if there is none, execution stops and the error is
+// returned to the caller.
+func (vm *VM) Run() error {
+	if err := vm.run(0); err != nil {
+		return err
+	}
+	return nil
+}
+
+// run executes instructions until the number of frames drops to depth. A
+// runtime error unwinds to the innermost try expression running in those
+// frames; if there is none it is returned, for the caller to pass on to the
+// frames below depth.
+func (vm *VM) run(depth int) *value.Error {
+	for {
+		err := vm.execute(depth)
+		if err == nil {
+			return nil
+		}
+		if len(vm.handlers) == 0 || vm.handlers[len(vm.handlers)-1].frame < depth {
+			return err
+		}
+		vm.unwind(err)
+	}
+}
+
+// call calls a function value and returns its result. Builtins use it to
+// call back into the program: a closure runs on the VM's own stack until it
+// returns, and a runtime error it does not catch is raised to the builtin's
+// caller.
+func (vm *VM) call(fn interface{}, args ...interface{}) interface{} {
+	switch f := fn.(type) {
+	case value.Builtin:
+		return f(vm.call, args)
+	case *value.VariantDecl:
+		return value.NewVariant(f, args)
+	case *Closure:
+		depth := len(vm.frames)
+		vm.push(f)
+		for _, arg := range args {
+			vm.push(arg)
+		}
+		vm.callClosure(f, len(args), nil)
+		if err := vm.run(depth); err != nil {
+			panic(err)
+		}
+		return vm.pop()
+	}
+	panic(value.Errorf("not a function"))
+}
+
+// callClosure enters a closure whose arguments are on top of the stack,
+// above the closure itself.
+func (vm *VM) callClosure(closure *Closure, nargs int, names []string) {
+	values, given := closure.Chunk.Signature.Bind(vm.stack[len(vm.stack)-nargs:], names)
+	callee := newFrame(closure, len(vm.stack)-nargs-1)
+	for i, v := range values {
+		if given[i] {
+			callee.locals[i] = v
+		} else {
+			callee.locals[i] = missingArg{}
+		}
+	}
+	vm.stack = vm.stack[:callee.base]
+	vm.frames = append(vm.frames, callee)
+}
+
+// unwind transfers control to the innermost handler, with err on the stack.
+func (vm *VM) unwind(err *value.Error) {
+	h := vm.handlers[len(vm.handlers)-1]
+	vm.handlers = vm.handlers[:len(vm.handlers)-1]
+	vm.frames = vm.frames[:h.frame+1]
+	frame := vm.frame()
+	frame.closeUpvalues(h.firstLocal)
+	frame.ip = h.ip
+	vm.stack = vm.stack[:h.stack]
+	vm.push(err)
+}
+
+// execute runs instructions until the program ends, the number of frames
+// drops to depth, or a runtime error is raised.
+func (vm *VM) execute(depth int) (err *value.Error) {
+	defer func() {
+		if r := recover(); r != nil {
+			rtErr, ok := r.(*value.Error)
+			if !ok {
+				panic(r)
+			}
+			err = rtErr
+		}
+	}()
+
+	for {
+		frame := vm.frame()
+		if frame.ip >= len(frame.closure.Chunk.Code) {
+			return nil
+		}
 		op := Opcode(vm.readByte())
 		switch op {
 		case OpConstant:
-			index := vm.readByte()
-			vm.push(vm.chunk.Constants[index])
+			vm.push(vm.readConstant())
 		case OpIndex:
 			index := vm.pop()
-			value := vm.pop()
-			switch v := value.(type) {
-			case []interface{}:
-				idx, ok := index.(int)
-				if !ok {
-					panic("Array index must be an integer")
-				}
-				if idx < 0 || idx >= len(v) {
-					panic("Array index out of bounds")
-				}
-				vm.push(v[idx])
-			case map[interface{}]interface{}:
-				val, exists := v[index]
-				if !exists {
-					panic(fmt.Sprintf("Key not found in dictionary: %v", index))
-				}
-				vm.push(val)
-			default:
-				panic(fmt.Sprintf("Cannot index into value of type %T", value))
+			vm.push(value.Index(vm.pop(), index))
+		case OpSetIndex:
+			val := vm.pop()
+			index := vm.pop()
+			container := vm.pop()
+			value.SetIndex(container, index, val)
+		case OpTuple:
+			size := int(vm.readByte())
+			tuple := make(value.Tuple, size)
+			copy(tuple, vm.stack[len(vm.stack)-size:])
+			vm.stack = vm.stack[:len(vm.stack)-size]
+			vm.push(tuple)
+		case OpRecord:
+			decl := vm.readConstant().(*value.RecordDecl)
+			size := int(vm.readByte())
+			names := make([]string, size)
+			values := make([]interface{}, size)
+			for i := size - 1; i >= 0; i-- {
+				names[i] = vm.pop().(string)
+				values[i] = vm.pop()
 			}
+			vm.push(value.NewRecord(decl, names, values))
+		case OpGetField:
+			name := vm.readConstant().(string)
+			vm.push(value.GetField(vm.pop(), name))
+		case OpSetField:
+			name := vm.readConstant().(string)
+			val := vm.pop()
+			value.SetField(vm.pop(), name, val)
 		case OpDict:
 			size := vm.readByte()
 			dict := make(map[interface{}]interface{})
 			for i := 0; i < int(size); i++ {
 				key := vm.pop()
 				val := vm.pop()
-				dict[key] = val
+				dict[value.CheckKey(key)] = val
 			}
 			vm.push(dict)
 		case OpArray:
@@ -105,147 +348,257 @@ func (vm *VM) Run() {
 		case OpAdd:
 			b := vm.pop()
 			a := vm.pop()
-			switch aVal := a.(type) {
-			case int:
-				if bVal, ok := b.(int); ok {
-					vm.push(aVal + bVal)
-				} else {
-					panic("Cannot add non-integer to integer")
-				}
-			case string:
-				if bVal, ok := b.(string); ok {
-					vm.push(aVal + bVal)
-				} else {
-					panic("Cannot add non-string to string")
-				}
-			default:
-				panic("Cannot add non-numeric, non-string values")
-			}
+			vm.push(value.Add(a, b))
 		case OpSub:
-			b := vm.pop().(int)
-			a := vm.pop().(int)
-			vm.push(a - b)
+			b := vm.pop()
+			a := vm.pop()
+			vm.push(value.Sub(a, b))
+		case OpMul:
+			b := vm.pop()
+			a := vm.pop()
+			vm.push(value.Mul(a, b))
+		case OpDiv:
+			b := vm.pop()
+			a := vm.pop()
+			vm.push(value.Div(a, b))
+		case OpMod:
+			b := vm.pop()
+			a := vm.pop()
+			vm.push(value.Mod(a, b))
 		case OpEqual:
 			b := vm.pop()
 			a := vm.pop()
-			vm.push(a == b)
+			vm.push(value.Equal(a, b))
+		case OpNotEqual:
+			b := vm.pop()
+			a := vm.pop()
+			vm.push(!value.Equal(a, b))
 		case OpGreater:
-			b := vm.pop().(int)
-			a := vm.pop().(int)
-			vm.push(a > b)
+			b := vm.pop()
+			a := vm.pop()
+			vm.push(value.Compare(a, b) > 0)
+		case OpGreaterEqual:
+			b := vm.pop()
+			a := vm.pop()
+			vm.push(value.Compare(a, b) >= 0)
 		case OpLess:
-			b := vm.pop().(int)
-			a := vm.pop().(int)
-			vm.push(a < b)
+			b := vm.pop()
+			a := vm.pop()
+			vm.push(value.Compare(a, b) < 0)
+		case OpLessEqual:
+			b := vm.pop()
+			a := vm.pop()
+			vm.push(value.Compare(a, b) <= 0)
+		case OpNot:
+			vm.push(!vm.truthy(vm.pop()))
+		case OpDefault:
+			slot := vm.readByte()
+			offset := vm.readShort()
+			if _, missing := frame.locals[slot].(missingArg); !missing {
+				frame.ip += offset
+			}
+		case OpNegate:
+			vm.push(value.Negate(vm.pop()))
 		case OpPop:
 			vm.pop()
+		case OpConcat:
+			count := int(vm.readByte())
+			var sb strings.Builder
+			for _, part := range vm.stack[len(vm.stack)-count:] {
+				sb.WriteString(value.Format(part))
+			}
+			vm.stack = vm.stack[:len(vm.stack)-count]
+			vm.push(sb.String())
 		case OpPrint:
 			val := vm.pop()
-			fmt.Println(val)
+			fmt.Fprintln(vm.out, value.Format(val))
 		case OpDefineGlobal:
-			nameIdx := vm.readByte()
-			name := vm.chunk.Constants[nameIdx].(string)
+			name := vm.readConstant().(string)
 			val := vm.pop()
 			vm.globals[name] = val
 		case OpGetGlobal:
-			nameIdx := vm.readByte()
-			name := vm.chunk.Constants[nameIdx].(string)
-			if val, ok := vm.locals[name]; ok {
+			name := vm.readConstant().(string)
+			if val, ok := vm.globals[name]; ok {
 				vm.push(val)
-			} else if val, ok := vm.globals[name]; ok {
-				vm.push(val)
-			} else if name == "print" {
-				// Special handling for print function
-				vm.push("print")
+			} else if builtin, ok := vm.builtins[name]; ok {
+				vm.push(builtin)
 			} else {
-				panic(fmt.Sprintf("Undefined variable: %s", name))
+				panic(value.Errorf("undefined variable: %s", name))
+			}
+		case OpSetGlobal:
+			name := vm.readConstant().(string)
+			if _, ok := vm.globals[name]; !ok {
+				panic(value.Errorf("undefined variable: %s", name))
 			}
+			vm.globals[name] = vm.pop()
+		case OpGetLocal:
+			slot := vm.readByte()
+			vm.push(frame.locals[slot])
+		case OpSetLocal:
+			slot := vm.readByte()
+			frame.locals[slot] = vm.pop()
+		case OpGetUpvalue:
+			idx := vm.readByte()
+			vm.push(*frame.closure.Upvalues[idx].location)
+		case OpSetUpvalue:
+			idx := vm.readByte()
+			*frame.closure.Upvalues[idx].location = vm.pop()
+		case OpCloseUpvalues:
+			frame.closeUpvalues(int(vm.readByte()))
+		case OpTry:
+			firstLocal := int(vm.readByte())
+			offset := vm.readShort()
+			vm.handlers = append(vm.handlers, handler{
+				frame:      len(vm.frames) - 1,
+				stack:      len(vm.stack),
+				firstLocal: firstLocal,
+				ip:         frame.ip + offset,
+			})
+		case OpEndTry:
+			vm.handlers = vm.handlers[:len(vm.handlers)-1]
+		case OpNil:
+			vm.push(nil)
 		case OpJumpIfFalse:
-			offset := vm.readByte()
+			offset := vm.readShort()
 			if !vm.truthy(vm.peek()) {
-				vm.ip = int(offset)
+				frame.ip += offset
 			}
 		case OpJumpIfTrue:
-			offset := vm.readByte()
+			offset := vm.readShort()
 			if vm.truthy(vm.peek()) {
-				vm.ip = int(offset)
+				frame.ip += offset
 			}
 		case OpJump:
-			offset := vm.readByte()
-			vm.ip = int(offset)
-		case OpCall:
-			nargs := vm.readByte()
-			args := make([]interface{}, int(nargs))
-			for i := int(nargs) - 1; i >= 0; i-- {
-				args[i] = vm.pop()
+			offset := vm.readShort()
+			frame.ip += offset
+		case OpLoop:
+			offset := vm.readShort()
+			frame.ip -= offset
+		case OpMatch:
+			pattern := vm.readConstant().(*Pattern)
+			vm.push(pattern.match(vm.pop(), frame.locals))
+		case OpDestructure:
+			pattern := vm.readConstant().(*Pattern)
+			if val := vm.pop(); !pattern.match(val, frame.locals) {
+				panic(value.Errorf("let pattern does not match value: %s", value.Format(val)))
 			}
-			callee := vm.pop()
-			if callee == nil {
-				panic("Cannot call nil")
+		case OpNoMatch:
+			panic(value.Errorf("no match arm for value: %s", value.Format(vm.pop())))
+		case OpIter:
+			vm.push(&iterator{items: value.Iterate(vm.pop())})
+		case OpRange:
+			end := vm.pop()
+			start := vm.pop()
+			from, to := value.RangeBounds(start, end)
+			vm.push(&iterator{isRange: true, next: from, end: to})
+		case OpForNext:
+			slot := vm.readByte()
+			offset := vm.readShort()
+			if item, ok := frame.locals[slot].(*iterator).advance(); ok {
+				vm.push(item)
+			} else {
+				frame.ip += offset
 			}
-			switch fn := callee.(type) {
-			case *Closure:
-				subVM := New(fn.Chunk)
-				subVM.globals = vm.globals
-				for i, param := range fn.Chunk.Params {
-					subVM.locals[param] = args[i]
-				}
-				subVM.Run()
-				if len(subVM.stack) > 0 {
-					vm.push(subVM.stack[len(subVM.stack)-1])
-				} else {
-					vm.push(nil)
-				}
-			case string:
-				if fn == "print" {
-					// For print, just push the last argument without printing
-					if len(args) > 0 {
-						vm.push(args[len(args)-1])
-					} else {
-						vm.push(nil)
-					}
+		case OpCall, OpCallNamed:
+			nargs := int(vm.readByte())
+			// Parameter names of the arguments, "" for positional ones
+			var names []string
+			if op == OpCallNamed {
+				names = vm.readConstant().([]string)
+			}
+			fnVal := vm.stack[len(vm.stack)-nargs-1]
+			if fnVal == nil {
+				panic(value.Errorf("not a function"))
+			}
+			if builtin, ok := fnVal.(value.Builtin); ok {
+				value.PositionalOnly(names)
+				result := builtin(vm.call, vm.stack[len(vm.stack)-nargs:])
+				vm.stack = vm.stack[:len(vm.stack)-nargs-1]
+				vm.push(result)
+				continue
+			}
+			if ctor, ok := fnVal.(*value.VariantDecl); ok {
+				value.PositionalOnly(names)
+				variant := value.NewVariant(ctor, vm.stack[len(vm.stack)-nargs:])
+				vm.stack = vm.stack[:len(vm.stack)-nargs-1]
+				vm.push(variant)
+				continue
+			}
+			closure, ok := fnVal.(*Closure)
+			if !ok {
+				panic(value.Errorf("not a function"))
+			}
+			vm.callClosure(closure, nargs, names)
+		case OpClosure:
+			fnChunk := vm.readConstant().(*Chunk)
+			closure := &Closure{
+				Chunk:    fnChunk,
+				Upvalues: make([]*Upvalue, len(fnChunk.Upvalues)),
+			}
+			for i, ref := range fnChunk.Upvalues {
+				if ref.IsLocal {
+					closure.Upvalues[i] = frame.captureUpvalue(ref.Index)
 				} else {
-					// Look up function in globals
-					if val, ok := vm.globals[fn]; ok {
-						if closure, ok := val.(*Closure); ok {
-							subVM := New(closure.Chunk)
-							subVM.globals = vm.globals
-							for i, param := range closure.Chunk.Params {
-								subVM.locals[param] = args[i]
-							}
-							subVM.Run()
-							if len(subVM.stack) > 0 {
-								vm.push(subVM.stack[len(subVM.stack)-1])
-							} else {
-								vm.push(nil)
-							}
-						} else {
-							panic(fmt.Sprintf("Cannot call non-function: %v", val))
-						}
-					} else {
-						panic(fmt.Sprintf("Undefined function: %s", fn))
-					}
+					closure.Upvalues[i] = frame.closure.Upvalues[ref.Index]
 				}
-			default:
-				panic(fmt.Sprintf("Cannot call non-function: %v", fn))
 			}
-		case OpClosure:
-			fnIdx := vm.readByte()
-			fnChunk := vm.chunk.Constants[fnIdx].(*Chunk)
-			vm.push(&Closure{Chunk: fnChunk})
+			vm.push(closure)
 		case OpReturn:
-			if len(vm.stack) > 0 {
-				retVal := vm.stack[len(vm.stack)-1]
-				vm.stack = vm.stack[:len(vm.stack)-1]
-				vm.push(retVal)
+			var result interface{}
+			if len(vm.stack) > frame.base {
+				result = vm.pop()
+			}
+			vm.stack = vm.stack[:frame.base]
+			vm.frames = vm.frames[:len(vm.frames)-1]
+			vm.push(result)
+			if len(vm.frames) == depth {
+				return nil
 			}
-			return
 		default:
 			panic(fmt.Sprintf("Unknown opcode: %d", op))
 		}
 	}
 }
 
+func newFrame(closure *Closure, base int) *CallFrame {
+	return &CallFrame{
+		closure: closure,
+		ip:      0,
+		base:    base,
+		locals:  make([]interface{}, closure.Chunk.NumLocals),
+	}
+}
+
+// closeUpvalues moves the values of captured locals from slot from upward
+// into their upvalues, so that the slots can be reused.
+func (f *CallFrame) closeUpvalues(from int) {
+	for slot, upvalue := range f.openUpvalues {
+		if slot >= from {
+			upvalue.closed = *upvalue.location
+			upvalue.location = &upvalue.closed
+			delete(f.openUpvalues, slot)
+		}
+	}
+}
+
+// captureUpvalue returns the open upvalue for a local slot, creating it if
+// needed so that closures sharing a variable also share its upvalue.
+func (f *CallFrame) captureUpvalue(slot int) *Upvalue {
+	if upvalue, ok := f.openUpvalues[slot]; ok {
+		return upvalue
+	}
+	if f.openUpvalues == nil {
+		f.openUpvalues = map[int]*Upvalue{}
+	}
+	upvalue := &Upvalue{location: &f.locals[slot]}
+	f.openUpvalues[slot] = upvalue
+	return upvalue
+}
+
+func (vm *VM) frame() *CallFrame {
+	return vm.frames[len(vm.frames)-1]
+}
+
 func (vm *VM) push(val interface{}) {
 	vm.stack = append(vm.stack, val)
 }
@@ -267,17 +620,33 @@ func (vm *VM) peek() interface{} {
 }
 
 func (vm *VM) readByte() byte {
-	b := vm.chunk.Code[vm.ip]
-	vm.ip++
+	frame := vm.frame()
+	b := frame.closure.Chunk.Code[frame.ip]
+	frame.ip++
 	return b
 }
 
+// readShort reads a 16-bit big-endian operand, as used by jumps and
+// constant indexes.
+func (vm *VM) readShort() int {
+	hi := vm.readByte()
+	lo := vm.readByte()
+	return int(hi)<<8 | int(lo)
+}
+
+// readConstant reads a constant index and returns the constant.
+func (vm *VM) readConstant() interface{} {
+	return vm.frame().closure.Chunk.Constants[vm.readShort()]
+}
+
 func (vm *VM) truthy(v interface{}) bool {
 	switch val := v.(type) {
 	case bool:
 		return val
 	case int:
 		return val != 0
+	case float64:
+		return val != 0
 	case string:
 		return val != ""
 	default: